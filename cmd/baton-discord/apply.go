@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ConductorOne/baton-discord/pkg/connector"
+)
+
+// approvalFile lists the changes of a plan for review. Only the changes marked as approved are applied.
+type approvalFile struct {
+	Guild   string      `yaml:"guild"`
+	Changes []*approval `yaml:"changes"`
+}
+
+type approval struct {
+	ID          string `yaml:"id"`
+	Description string `yaml:"description"`
+	Approved    bool   `yaml:"approved"`
+}
+
+func applyCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply <desired-state-file>",
+		Short: "Grant and revoke role memberships and channel overwrites to match a desired state",
+		Long: `Grant and revoke role memberships and channel overwrites to match a desired state.
+
+With --dry-run, the plan is only printed, and written to the --approval-file for review. Otherwise, only the changes
+marked as approved in the --approval-file are made, or every change with --approve-all. Changes already in effect are
+never planned, so apply can be run again after a partial or failed run.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun, err := cmd.Flags().GetBool("dry-run")
+			if err != nil {
+				return err
+			}
+			approvalPath, err := cmd.Flags().GetString("approval-file")
+			if err != nil {
+				return err
+			}
+			approveAll, err := cmd.Flags().GetBool("approve-all")
+			if err != nil {
+				return err
+			}
+			if !dryRun && approvalPath == "" && !approveAll {
+				return errors.New("either --approval-file or --approve-all is required, unless --dry-run is set")
+			}
+			if approvalPath != "" && approveAll {
+				return errors.New("--approval-file and --approve-all can't be used together")
+			}
+
+			state, err := readDesiredState(args[0])
+			if err != nil {
+				return err
+			}
+
+			var approvals *approvalFile
+			if approvalPath != "" && !dryRun {
+				if approvals, err = readApprovalFile(approvalPath); err != nil {
+					return err
+				}
+				if approvals.Guild != state.Guild {
+					return fmt.Errorf("approval file %s is of guild %s, not %s", approvalPath, approvals.Guild, state.Guild)
+				}
+			}
+
+			cb, err := newSubcommandConnector(ctx, cmd)
+			if err != nil {
+				return err
+			}
+
+			changes, err := cb.Plan(ctx, state)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if len(changes) == 0 {
+				fmt.Fprintf(out, "Guild %s already matches %s\n", state.Guild, args[0])
+				return nil
+			}
+
+			if dryRun {
+				for _, change := range changes {
+					fmt.Fprintf(out, "would %s\n", change.Description)
+				}
+				if approvalPath != "" {
+					return writeApprovalFile(approvalPath, state.Guild, changes)
+				}
+				return nil
+			}
+
+			applied := 0
+			for _, change := range changes {
+				if approvals != nil && !approvals.approved(change.ID) {
+					fmt.Fprintf(out, "skipped, not approved: %s\n", change.Description)
+					continue
+				}
+				if err := cb.Apply(ctx, change); err != nil {
+					return fmt.Errorf("error applying %s after %d changes: %w", change.Description, applied, err)
+				}
+				fmt.Fprintf(out, "applied: %s\n", change.Description)
+				applied++
+			}
+			fmt.Fprintf(out, "%d of %d changes applied\n", applied, len(changes))
+			return nil
+		},
+	}
+	cmd.Flags().Bool("dry-run", false, "Print the changes without making them.")
+	cmd.Flags().String("approval-file", "", "With --dry-run, write the changes to this file for approval. Otherwise, only make the changes approved in it.")
+	cmd.Flags().Bool("approve-all", false, "Make every change without an approval file.")
+	return cmd
+}
+
+// readDesiredState reads a desired state in either YAML or JSON.
+func readDesiredState(path string) (*connector.DesiredState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &connector.DesiredState{}
+	if err := yaml.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid desired state %s: %w", path, err)
+	}
+	if err := connector.CheckDesiredStateVersion(state); err != nil {
+		return nil, fmt.Errorf("invalid desired state %s: %w", path, err)
+	}
+	return state, nil
+}
+
+func readApprovalFile(path string) (*approvalFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	approvals := &approvalFile{}
+	if err := yaml.Unmarshal(data, approvals); err != nil {
+		return nil, fmt.Errorf("invalid approval file %s: %w", path, err)
+	}
+	return approvals, nil
+}
+
+// writeApprovalFile writes the changes for approval. Approvals already in the file are kept for the changes that are
+// still planned, so a plan can be reviewed again without losing them.
+func writeApprovalFile(path string, guildID string, changes []*connector.Change) error {
+	previous := &approvalFile{}
+	if _, err := os.Stat(path); err == nil {
+		if previous, err = readApprovalFile(path); err != nil {
+			return err
+		}
+	}
+
+	approvals := &approvalFile{Guild: guildID, Changes: []*approval{}}
+	for _, change := range changes {
+		approvals.Changes = append(approvals.Changes, &approval{
+			ID:          change.ID,
+			Description: change.Description,
+			Approved:    previous.Guild == guildID && previous.approved(change.ID),
+		})
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := yaml.NewEncoder(f)
+	enc.SetIndent(2)
+	if err := enc.Encode(approvals); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func (a *approvalFile) approved(id string) bool {
+	for _, change := range a.Changes {
+		if change.ID == id {
+			return change.Approved
+		}
+	}
+	return false
+}
@@ -3,8 +3,18 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/conductorone/baton-sdk/pkg/cli"
+
+	"github.com/ConductorOne/baton-discord/pkg/connector"
+	"github.com/ConductorOne/baton-discord/pkg/fakediscord"
 )
 
 // config defines the external configuration required for the connector to run.
@@ -12,12 +22,279 @@ type config struct {
 	cli.BaseConfig `mapstructure:",squash"` // Puts the base config options in the same place as the connector options
 
 	Token string `mapstructure:",token"`
+	// The token can instead be read from a file, from a file named by an environment variable, or from the output of
+	// a command. It is read again when Discord rejects it, so a rotated token is picked up without a restart.
+	TokenFile    string `mapstructure:"token-file"`
+	TokenFileEnv string `mapstructure:"token-file-env"`
+	TokenCommand string `mapstructure:"token-command"`
+
+	// Tokens are the tokens of additional bots, each as name=token.
+	Tokens []string `mapstructure:"tokens"`
+
+	// Guild filters. When include rules are set, only matching guilds are synced; exclude rules always win.
+	GuildIDs          []string `mapstructure:"guild-ids"`
+	ExcludeGuildIDs   []string `mapstructure:"exclude-guild-ids"`
+	GuildNames        []string `mapstructure:"guild-names"`
+	ExcludeGuildNames []string `mapstructure:"exclude-guild-names"`
+
+	// Channel and role filters, applied within the synced guilds.
+	ChannelIDs               []string `mapstructure:"channel-ids"`
+	ExcludeChannelIDs        []string `mapstructure:"exclude-channel-ids"`
+	ChannelNames             []string `mapstructure:"channel-names"`
+	ExcludeChannelNames      []string `mapstructure:"exclude-channel-names"`
+	ChannelCategories        []string `mapstructure:"channel-categories"`
+	ExcludeChannelCategories []string `mapstructure:"exclude-channel-categories"`
+	ExcludeNSFWChannels      bool     `mapstructure:"exclude-nsfw-channels"`
+	RoleNames                []string `mapstructure:"role-names"`
+	ExcludeRoleNames         []string `mapstructure:"exclude-role-names"`
+	ExcludeManagedRoles      bool     `mapstructure:"exclude-managed-roles"`
+
+	// BotMode is one of "user", "exclude" or "separate".
+	BotMode string `mapstructure:"bot-mode"`
+
+	// GuildConcurrency is the number of guilds fetched at once.
+	GuildConcurrency int `mapstructure:"guild-concurrency"`
+
+	// HTTP client settings. BaseURL replaces https://discord.com/, for example to go through an egress proxy that
+	// exposes the API under its own address.
+	BaseURL        string        `mapstructure:"base-url"`
+	HTTPProxy      string        `mapstructure:"http-proxy"`
+	RequestTimeout time.Duration `mapstructure:"request-timeout"`
+	CACertFiles    []string      `mapstructure:"ca-cert-files"`
+
+	// RecordFixture and ReplayFixture record the API responses of a sync to a file, and serve them back instead of
+	// calling Discord.
+	RecordFixture string `mapstructure:"record-fixture"`
+	ReplayFixture string `mapstructure:"replay-fixture"`
+}
+
+// tokenSources returns the number of ways the default bot's token is configured.
+func (c *config) tokenSources() int {
+	n := 0
+	for _, source := range []string{c.Token, c.TokenFile, c.TokenFileEnv, c.TokenCommand} {
+		if source != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// tokenSource returns the source of the default bot's token, or nil if it is passed directly.
+func (c *config) tokenSource() connector.TokenSource {
+	switch {
+	case c.TokenFile != "":
+		return fileTokenSource(func() (string, error) { return c.TokenFile, nil })
+	case c.TokenFileEnv != "":
+		return fileTokenSource(func() (string, error) {
+			path := os.Getenv(c.TokenFileEnv)
+			if path == "" {
+				return "", fmt.Errorf("environment variable %s is not set", c.TokenFileEnv)
+			}
+			return path, nil
+		})
+	case c.TokenCommand != "":
+		return commandTokenSource(c.TokenCommand)
+	default:
+		return nil
+	}
+}
+
+// fileTokenSource reads the token from the file at the path returned by path.
+func fileTokenSource(path func() (string, error)) connector.TokenSource {
+	return func(ctx context.Context) (string, error) {
+		p, err := path()
+		if err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+}
+
+// commandTokenSource runs the command with the shell and reads the token from its output.
+func commandTokenSource(command string) connector.TokenSource {
+	return func(ctx context.Context) (string, error) {
+		out, err := exec.CommandContext(ctx, "sh", "-c", command).Output()
+		if err != nil {
+			return "", fmt.Errorf("error running token command: %w", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+}
+
+// namedToken is the token of an additional bot.
+type namedToken struct {
+	name  string
+	token string
+}
+
+// botTokens returns the additional bot tokens, in the order they were configured.
+func (c *config) botTokens() ([]namedToken, error) {
+	tokens := make([]namedToken, 0, len(c.Tokens))
+	for _, entry := range c.Tokens {
+		name, token, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("invalid bot token %q: must be name=token", redactToken(entry))
+		}
+		tokens = append(tokens, namedToken{name: name, token: token})
+	}
+	return tokens, nil
+}
+
+// redactToken hides the token part of a name=token entry, so it can be shown in an error.
+func redactToken(entry string) string {
+	name, _, _ := strings.Cut(entry, "=")
+	return name + "=..."
+}
+
+func (c *config) guildFilter() *connector.GuildFilter {
+	return &connector.GuildFilter{
+		IncludeIDs:   c.GuildIDs,
+		ExcludeIDs:   c.ExcludeGuildIDs,
+		IncludeNames: c.GuildNames,
+		ExcludeNames: c.ExcludeGuildNames,
+	}
+}
+
+func (c *config) channelFilter() *connector.ChannelFilter {
+	return &connector.ChannelFilter{
+		IncludeIDs:        c.ChannelIDs,
+		ExcludeIDs:        c.ExcludeChannelIDs,
+		IncludeNames:      c.ChannelNames,
+		ExcludeNames:      c.ExcludeChannelNames,
+		IncludeCategories: c.ChannelCategories,
+		ExcludeCategories: c.ExcludeChannelCategories,
+		ExcludeNSFW:       c.ExcludeNSFWChannels,
+	}
+}
+
+func (c *config) roleFilter() *connector.RoleFilter {
+	return &connector.RoleFilter{
+		IncludeNames:   c.RoleNames,
+		ExcludeNames:   c.ExcludeRoleNames,
+		ExcludeManaged: c.ExcludeManagedRoles,
+	}
+}
+
+// connectorOptions returns the connector options described by the configuration.
+func (c *config) connectorOptions() ([]connector.Option, error) {
+	botMode, err := connector.ParseBotMode(c.BotMode)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []connector.Option{
+		connector.WithGuildFilter(c.guildFilter()),
+		connector.WithChannelFilter(c.channelFilter()),
+		connector.WithRoleFilter(c.roleFilter()),
+		connector.WithBotMode(botMode),
+		connector.WithGuildConcurrency(c.GuildConcurrency),
+		connector.WithRequestTimeout(c.RequestTimeout),
+	}
+
+	if source := c.tokenSource(); source != nil {
+		opts = append(opts, connector.WithTokenSource(source))
+	}
+
+	if c.BaseURL != "" {
+		opts = append(opts, connector.WithBaseURL(c.BaseURL))
+	}
+
+	botTokens, err := c.botTokens()
+	if err != nil {
+		return nil, err
+	}
+	for _, bt := range botTokens {
+		opts = append(opts, connector.WithBotToken(bt.name, bt.token))
+	}
+
+	for _, path := range c.CACertFiles {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificates: %w", err)
+		}
+		opts = append(opts, connector.WithCACertificates(pem))
+	}
+
+	if c.HTTPProxy != "" {
+		proxyURL, err := url.Parse(c.HTTPProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http proxy: %w", err)
+		}
+		opts = append(opts, connector.WithHTTPProxy(proxyURL))
+	}
+
+	if c.RecordFixture != "" {
+		opts = append(opts, connector.WithTransport(func(next http.RoundTripper) http.RoundTripper {
+			return fakediscord.NewRecorder(next, c.RecordFixture)
+		}))
+	}
+
+	if c.ReplayFixture != "" {
+		recording, err := fakediscord.LoadRecording(c.ReplayFixture)
+		if err != nil {
+			return nil, err
+		}
+		// The server runs for as long as the process does.
+		server, err := fakediscord.NewReplayServer(recording)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, connector.WithBaseURL(server.URL))
+		// Any token will do, since nothing is sent to Discord.
+		if c.tokenSources() == 0 && len(botTokens) == 0 {
+			opts = append(opts, connector.WithBotToken("replay", "replay"))
+		}
+	}
+
+	return opts, nil
 }
 
 // validateConfig is run after the configuration is loaded, and should return an error if it isn't valid.
 func validateConfig(ctx context.Context, cfg *config) error {
-	if cfg.Token == "" {
+	if cfg.tokenSources() == 0 && len(cfg.Tokens) == 0 && cfg.ReplayFixture == "" {
 		return errors.New("token is empty")
 	}
+	if cfg.tokenSources() > 1 {
+		return errors.New("only one of token, token-file, token-file-env and token-command can be set")
+	}
+	if _, err := cfg.botTokens(); err != nil {
+		return err
+	}
+	if cfg.RecordFixture != "" && cfg.ReplayFixture != "" {
+		return errors.New("record-fixture and replay-fixture can't be used together")
+	}
+	if cfg.BaseURL != "" && cfg.ReplayFixture != "" {
+		return errors.New("base-url and replay-fixture can't be used together")
+	}
+	for name, value := range map[string]string{"base-url": cfg.BaseURL, "http-proxy": cfg.HTTPProxy} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%s must be an absolute URL, got %q", name, value)
+		}
+	}
+	if cfg.RequestTimeout < 0 {
+		return fmt.Errorf("request timeout must not be negative, got %s", cfg.RequestTimeout)
+	}
+	if err := cfg.guildFilter().ValidatePatterns(); err != nil {
+		return fmt.Errorf("invalid guild name filter: %w", err)
+	}
+	if err := cfg.channelFilter().ValidatePatterns(); err != nil {
+		return fmt.Errorf("invalid channel filter: %w", err)
+	}
+	if err := cfg.roleFilter().ValidatePatterns(); err != nil {
+		return fmt.Errorf("invalid role name filter: %w", err)
+	}
+	if _, err := connector.ParseBotMode(cfg.BotMode); err != nil {
+		return err
+	}
+	if cfg.GuildConcurrency < 1 {
+		return fmt.Errorf("guild concurrency must be at least 1, got %d", cfg.GuildConcurrency)
+	}
 	return nil
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/ConductorOne/baton-discord/pkg/connector"
+)
+
+// loadSubcommandConfig populates cfg the same way the root command does: from flags, $BATON_ environment variables
+// and the baton config file, which is ./.baton.yaml unless $BATON_CONFIG_PATH names another.
+func loadSubcommandConfig(cmd *cobra.Command, cfg *config) error {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if path := os.Getenv("BATON_CONFIG_PATH"); path != "" {
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return errors.New("expected config file to have .yaml or .yml extension")
+		}
+		v.SetConfigFile(path)
+	} else {
+		v.SetConfigName(".baton")
+		v.AddConfigPath(".")
+	}
+	if err := v.ReadInConfig(); err != nil && !errors.As(err, &viper.ConfigFileNotFoundError{}) {
+		return err
+	}
+
+	v.SetEnvPrefix("baton")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+	if err := v.BindPFlags(cmd.Flags()); err != nil {
+		return err
+	}
+
+	return v.Unmarshal(cfg)
+}
+
+// newSubcommandConnector creates the connector for a subcommand from its configuration.
+func newSubcommandConnector(ctx context.Context, cmd *cobra.Command) (*connector.Connector, error) {
+	cfg := &config{}
+	if err := loadSubcommandConfig(cmd, cfg); err != nil {
+		return nil, err
+	}
+	if err := validateConfig(ctx, cfg); err != nil {
+		return nil, err
+	}
+
+	opts, err := cfg.connectorOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	return connector.New(ctx, cfg.Token, opts...)
+}
+
+func explainCmd(ctx context.Context) *cobra.Command {
+	return &cobra.Command{
+		Use:   "explain <user-id> <channel-id>",
+		Short: "Explain how the effective permissions of a user in a channel are computed",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cb, err := newSubcommandConnector(ctx, cmd)
+			if err != nil {
+				return err
+			}
+
+			explanation, err := cb.Explain(ctx, args[0], args[1])
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Member %s in #%s (%s)\n\n", explanation.Member.User.Username, explanation.Channel.Name, explanation.Guild.Name)
+			for i, step := range explanation.Steps {
+				fmt.Fprintf(out, "%d. %s\n", i+1, step.Description)
+				fmt.Fprintf(out, "   allow:  %s\n", strings.Join(connector.PermissionNames(step.Allow), ", "))
+				fmt.Fprintf(out, "   deny:   %s\n", strings.Join(connector.PermissionNames(step.Deny), ", "))
+				fmt.Fprintf(out, "   result: %s\n", strings.Join(connector.PermissionNames(step.Result), ", "))
+			}
+
+			fmt.Fprintln(out, "\nFinal permissions:")
+			for _, permission := range explanation.Permissions() {
+				result := "denied"
+				if permission.Granted {
+					result = "granted"
+				}
+				fmt.Fprintf(out, "  %-24s %s\n", permission.Name, result)
+			}
+
+			return nil
+		},
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/conductorone/baton-sdk/pkg/cli"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
@@ -30,6 +31,9 @@ func main() {
 	cmd.Version = version
 
 	cmdFlags(cmd)
+	cmd.AddCommand(explainCmd(ctx))
+	cmd.AddCommand(templateCmd(ctx))
+	cmd.AddCommand(applyCmd(ctx))
 	err = cmd.Execute()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
@@ -40,7 +44,13 @@ func main() {
 func getConnector(ctx context.Context, cfg *config) (types.ConnectorServer, error) {
 	l := ctxzap.Extract(ctx)
 
-	cb, err := connector.New(ctx, cfg.Token)
+	opts, err := cfg.connectorOptions()
+	if err != nil {
+		l.Error("error creating connector", zap.Error(err))
+		return nil, err
+	}
+
+	cb, err := connector.New(ctx, cfg.Token, opts...)
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
 		return nil, err
@@ -57,4 +67,30 @@ func getConnector(ctx context.Context, cfg *config) (types.ConnectorServer, erro
 
 func cmdFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().String("token", "", "The discord bot token. ($BATON_TOKEN)")
+	cmd.PersistentFlags().String("token-file", "", "Read the discord bot token from this file, such as a mounted secret. ($BATON_TOKEN_FILE)")
+	cmd.PersistentFlags().String("token-file-env", "", "Read the discord bot token from the file named by this environment variable. ($BATON_TOKEN_FILE_ENV)")
+	cmd.PersistentFlags().String("token-command", "", "Read the discord bot token from the output of this shell command. ($BATON_TOKEN_COMMAND)")
+	cmd.PersistentFlags().StringSlice("tokens", nil, "The tokens of additional bots, as name=token. Guilds visible to more than one bot are synced through the bot with the most permissions. ($BATON_TOKENS)")
+	cmd.PersistentFlags().StringSlice("guild-ids", nil, "Only sync the guilds with these IDs. ($BATON_GUILD_IDS)")
+	cmd.PersistentFlags().StringSlice("exclude-guild-ids", nil, "Never sync the guilds with these IDs. ($BATON_EXCLUDE_GUILD_IDS)")
+	cmd.PersistentFlags().StringSlice("guild-names", nil, "Only sync the guilds whose name matches one of these glob patterns. ($BATON_GUILD_NAMES)")
+	cmd.PersistentFlags().StringSlice("exclude-guild-names", nil, "Never sync the guilds whose name matches one of these glob patterns. ($BATON_EXCLUDE_GUILD_NAMES)")
+	cmd.PersistentFlags().StringSlice("channel-ids", nil, "Only sync the channels with these IDs. ($BATON_CHANNEL_IDS)")
+	cmd.PersistentFlags().StringSlice("exclude-channel-ids", nil, "Never sync the channels with these IDs. ($BATON_EXCLUDE_CHANNEL_IDS)")
+	cmd.PersistentFlags().StringSlice("channel-names", nil, "Only sync the channels whose name matches one of these glob patterns. ($BATON_CHANNEL_NAMES)")
+	cmd.PersistentFlags().StringSlice("exclude-channel-names", nil, "Never sync the channels whose name matches one of these glob patterns. ($BATON_EXCLUDE_CHANNEL_NAMES)")
+	cmd.PersistentFlags().StringSlice("channel-categories", nil, "Only sync the channels whose category ID or name matches one of these glob patterns. ($BATON_CHANNEL_CATEGORIES)")
+	cmd.PersistentFlags().StringSlice("exclude-channel-categories", nil, "Never sync the channels whose category ID or name matches one of these glob patterns. ($BATON_EXCLUDE_CHANNEL_CATEGORIES)")
+	cmd.PersistentFlags().Bool("exclude-nsfw-channels", false, "Never sync channels marked as NSFW. ($BATON_EXCLUDE_NSFW_CHANNELS)")
+	cmd.PersistentFlags().StringSlice("role-names", nil, "Only sync the roles whose name matches one of these glob patterns. ($BATON_ROLE_NAMES)")
+	cmd.PersistentFlags().StringSlice("exclude-role-names", nil, "Never sync the roles whose name matches one of these glob patterns. ($BATON_EXCLUDE_ROLE_NAMES)")
+	cmd.PersistentFlags().Bool("exclude-managed-roles", false, "Never sync roles managed by an integration. ($BATON_EXCLUDE_MANAGED_ROLES)")
+	cmd.PersistentFlags().String("bot-mode", "user", "How to sync bot accounts: user, exclude or separate. ($BATON_BOT_MODE)")
+	cmd.PersistentFlags().Int("guild-concurrency", 4, "The number of guilds whose members, roles and channels are fetched at once. ($BATON_GUILD_CONCURRENCY)")
+	cmd.PersistentFlags().String("base-url", "", "The base URL of the Discord API, if not https://discord.com/. ($BATON_BASE_URL)")
+	cmd.PersistentFlags().String("http-proxy", "", "The proxy to send Discord API and gateway traffic through. ($BATON_HTTP_PROXY)")
+	cmd.PersistentFlags().Duration("request-timeout", 20*time.Second, "How long a single Discord API request may take. ($BATON_REQUEST_TIMEOUT)")
+	cmd.PersistentFlags().StringSlice("ca-cert-files", nil, "PEM files of CA certificates to trust, in addition to the system ones, for connections to Discord. ($BATON_CA_CERT_FILES)")
+	cmd.PersistentFlags().String("record-fixture", "", "Record the Discord API responses, with tokens and personal information redacted, to this file. ($BATON_RECORD_FIXTURE)")
+	cmd.PersistentFlags().String("replay-fixture", "", "Serve the Discord API responses recorded in this file instead of calling Discord. ($BATON_REPLAY_FIXTURE)")
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ConductorOne/baton-discord/pkg/connector"
+)
+
+func templateCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "template",
+		Short: "Export the access template of a guild, or check a guild for drift from one",
+	}
+	cmd.AddCommand(templateExportCmd(ctx), templateDriftCmd(ctx))
+	return cmd
+}
+
+func templateExportCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <guild-id>",
+		Short: "Write the roles, permissions, categories, channels and overwrites of a guild as an access template",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := cmd.Flags().GetString("format")
+			if err != nil {
+				return err
+			}
+			output, err := cmd.Flags().GetString("output")
+			if err != nil {
+				return err
+			}
+			if format != "yaml" && format != "json" {
+				return fmt.Errorf("unknown template format %q, expected yaml or json", format)
+			}
+
+			cb, err := newSubcommandConnector(ctx, cmd)
+			if err != nil {
+				return err
+			}
+
+			template, err := cb.Template(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			if output == "" {
+				return writeTemplate(cmd.OutOrStdout(), template, format)
+			}
+
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			if err := writeTemplate(f, template, format); err != nil {
+				f.Close()
+				return err
+			}
+			// A failed write may only be reported when the file is closed.
+			return f.Close()
+		},
+	}
+	cmd.Flags().String("format", "yaml", "The format of the template: yaml or json.")
+	cmd.Flags().StringP("output", "o", "", "The file to write the template to, instead of standard output.")
+	return cmd
+}
+
+func templateDriftCmd(ctx context.Context) *cobra.Command {
+	return &cobra.Command{
+		Use:   "drift <guild-id> <template-file>",
+		Short: "Report how a guild has drifted from a saved access template, failing if it has",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			saved, err := readTemplate(args[1])
+			if err != nil {
+				return err
+			}
+
+			cb, err := newSubcommandConnector(ctx, cmd)
+			if err != nil {
+				return err
+			}
+
+			current, err := cb.Template(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if saved.Guild.ID != current.Guild.ID {
+				return fmt.Errorf("template %s is of guild %s, not %s", args[1], saved.Guild.ID, current.Guild.ID)
+			}
+
+			out := cmd.OutOrStdout()
+			drifts := connector.DiffTemplates(saved, current)
+			if len(drifts) == 0 {
+				fmt.Fprintf(out, "%s matches %s\n", current.Guild.Name, args[1])
+				return nil
+			}
+
+			for _, drift := range drifts {
+				fmt.Fprintln(out, drift)
+			}
+			return fmt.Errorf("%s has drifted from %s: %d differences", current.Guild.Name, args[1], len(drifts))
+		},
+	}
+}
+
+func writeTemplate(w io.Writer, template *connector.AccessTemplate, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(template)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(template); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// readTemplate reads an access template in either format, since JSON is also valid YAML.
+func readTemplate(path string) (*connector.AccessTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &connector.AccessTemplate{}
+	if err := yaml.Unmarshal(data, template); err != nil {
+		return nil, fmt.Errorf("invalid access template %s: %w", path, err)
+	}
+	if err := connector.CheckTemplateVersion(template); err != nil {
+		return nil, fmt.Errorf("invalid access template %s: %w", path, err)
+	}
+	return template, nil
+}
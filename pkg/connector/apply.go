@@ -0,0 +1,500 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/bwmarrin/discordgo"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+
+	"github.com/ConductorOne/baton-discord/pkg/snowflake"
+)
+
+// DesiredStateVersion is the version of the desired state format read by Plan. Files of any other version are
+// rejected by CheckDesiredStateVersion.
+const DesiredStateVersion = 1
+
+// DesiredState is the access a guild should have. Only the roles, channels and integrations it lists are managed;
+// everything else is left as it is.
+type DesiredState struct {
+	Version      int                   `json:"version" yaml:"version"`
+	Guild        string                `json:"guild" yaml:"guild"`
+	Roles        []*DesiredRole        `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Channels     []*DesiredChannel     `json:"channels,omitempty" yaml:"channels,omitempty"`
+	Integrations []*DesiredIntegration `json:"integrations,omitempty" yaml:"integrations,omitempty"`
+}
+
+// DesiredRole lists the IDs of the human members a role should have. Bots are managed through their integration.
+// Name is only for the reader.
+type DesiredRole struct {
+	ID      string   `json:"id" yaml:"id"`
+	Name    string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Members []string `json:"members" yaml:"members"`
+}
+
+// DesiredChannel lists the permission overwrites a channel should have, in the format of an access template. Only the
+// permissions the channel has entitlements for are managed; the other bits of an overwrite, and the overwrites of
+// roles excluded by the role filter and of bots excluded by the bot mode, are left as they are.
+type DesiredChannel struct {
+	ID         string               `json:"id" yaml:"id"`
+	Name       string               `json:"name,omitempty" yaml:"name,omitempty"`
+	Overwrites []*TemplateOverwrite `json:"overwrites" yaml:"overwrites"`
+}
+
+// DesiredIntegration lists the IDs of the roles the bot of an integration should have, besides the role managed by
+// the integration itself.
+type DesiredIntegration struct {
+	ID    string   `json:"id" yaml:"id"`
+	Name  string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Roles []string `json:"roles" yaml:"roles"`
+}
+
+// CheckDesiredStateVersion returns an error if the desired state was written in a format this version can't read.
+func CheckDesiredStateVersion(state *DesiredState) error {
+	if state.Version != DesiredStateVersion {
+		return fmt.Errorf("unsupported desired state version %d, expected %d", state.Version, DesiredStateVersion)
+	}
+	return nil
+}
+
+// The actions of a Change.
+const (
+	ChangeGrant  = "grant"
+	ChangeRevoke = "revoke"
+)
+
+// Change is a single grant or revoke of a plan. Its ID is derived from the entitlement and the principal, so the
+// same change has the same ID every time the plan is computed.
+type Change struct {
+	ID          string
+	Action      string
+	Description string
+
+	entitlement *v2.Entitlement
+	principal   *v2.Resource
+}
+
+func newChange(action string, en *v2.Entitlement, principal *v2.Resource) *Change {
+	return &Change{
+		ID:          fmt.Sprintf("%s %s %s:%s", action, en.Id, principal.Id.ResourceType, principal.Id.Resource),
+		Action:      action,
+		Description: fmt.Sprintf("%s %s: %s", action, en.DisplayName, principalName(principal)),
+		entitlement: en,
+		principal:   principal,
+	}
+}
+
+func principalName(principal *v2.Resource) string {
+	if principal.DisplayName == "" {
+		return fmt.Sprintf("%s %s", principal.Id.ResourceType, principal.Id.Resource)
+	}
+	return fmt.Sprintf("%s %s (%s)", principal.Id.ResourceType, principal.DisplayName, principal.Id.Resource)
+}
+
+// permValFromName is the reverse of permNameFromVal.
+var permValFromName = func() map[string]int64 {
+	perms := make(map[string]int64, len(permNameFromVal))
+	for permission, name := range permNameFromVal {
+		perms[name] = permission
+	}
+	return perms
+}()
+
+// planner holds what a plan is computed from.
+type planner struct {
+	d       *Connector
+	roles   *roleBuilder
+	guild   *discordgo.Guild
+	members map[string]*discordgo.Member
+}
+
+// Plan computes the changes that bring the guild to the desired state. Revokes come before grants, so that a
+// permission moving from deny to allow is never both. Changes already in effect aren't planned, so applying a plan
+// and planning again yields nothing.
+func (d *Connector) Plan(ctx context.Context, state *DesiredState) ([]*Change, error) {
+	if err := d.opts.guildFilter.checkGuildID(d.conn, state.Guild); err != nil {
+		return nil, err
+	}
+
+	p := &planner{d: d, roles: newRoleBuilder(d.conn, &d.opts)}
+	var err error
+	p.guild, err = p.roles.getGuild(state.Guild)
+	if err != nil {
+		return nil, err
+	}
+	p.members, err = p.roles.getMembers(state.Guild)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*Change
+	for _, desired := range state.Roles {
+		roleChanges, err := p.planRole(desired)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, roleChanges...)
+	}
+
+	if len(state.Integrations) > 0 {
+		if d.opts.botMode == BotModeExclude {
+			return nil, fmt.Errorf("the roles of integrations can't be managed while bots are excluded by the bot mode %q", BotModeExclude)
+		}
+		integrations, err := newBotBuilder(d.conn, &d.opts).integrations(state.Guild)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		for _, desired := range state.Integrations {
+			integrationChanges, err := p.planIntegration(desired, integrations)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, integrationChanges...)
+		}
+	}
+
+	if len(state.Channels) > 0 {
+		channels, err := d.conn.forGuild(state.Guild).GuildChannels(state.Guild)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		for _, desired := range state.Channels {
+			channelChanges, err := p.planChannel(desired, channels)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, channelChanges...)
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Action == ChangeRevoke && changes[j].Action == ChangeGrant
+	})
+	return changes, nil
+}
+
+// provisionedRole returns a role whose members can be managed.
+func (p *planner) provisionedRole(roleID string) (*discordgo.Role, error) {
+	role, err := p.roles.getRole(p.guild.ID, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !p.d.opts.roleFilter.Allows(role):
+		return nil, fmt.Errorf("role %s is excluded by the role filter", role.Name)
+	case isEveryoneRole(role, p.guild.ID):
+		return nil, fmt.Errorf("every member holds role %s", role.Name)
+	case role.Managed:
+		return nil, fmt.Errorf("role %s is managed by an integration", role.Name)
+	}
+	return role, nil
+}
+
+// memberPrincipal returns the principal of a guild member.
+func (p *planner) memberPrincipal(member *discordgo.Member) (*v2.Resource, error) {
+	principal, err := p.d.opts.newMemberPrincipal(member, p.guild)
+	if err != nil {
+		return nil, err
+	}
+	if principal == nil {
+		return nil, fmt.Errorf("member %s is excluded by the bot mode", member.User.ID)
+	}
+	return principal, nil
+}
+
+func (p *planner) planRole(desired *DesiredRole) ([]*Change, error) {
+	role, err := p.provisionedRole(desired.ID)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := newRoleResource(role, p.guild)
+	if err != nil {
+		return nil, err
+	}
+	en := newRoleAssignmentEntitlement(resource, role.Name)
+
+	var changes []*Change
+	for _, userID := range desired.Members {
+		member, ok := p.members[userID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownMember, userID)
+		}
+		if member.User.Bot {
+			return nil, fmt.Errorf("member %s of role %s is a bot, whose roles are set by its integration", userID, role.Name)
+		}
+		if contains(member.Roles, role.ID) {
+			continue
+		}
+
+		principal, err := p.memberPrincipal(member)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, newChange(ChangeGrant, en, principal))
+	}
+
+	for _, member := range sortedMembers(p.members) {
+		if member.User.Bot || !contains(member.Roles, role.ID) || contains(desired.Members, member.User.ID) {
+			continue
+		}
+
+		principal, err := p.memberPrincipal(member)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, newChange(ChangeRevoke, en, principal))
+	}
+
+	return changes, nil
+}
+
+func (p *planner) planIntegration(desired *DesiredIntegration, integrations map[string]*botIntegration) ([]*Change, error) {
+	var bot *discordgo.Member
+	for botID, integration := range integrations {
+		if integration.ID == desired.ID {
+			bot = p.members[botID]
+		}
+	}
+	if bot == nil {
+		return nil, fmt.Errorf("no bot of integration %s is a member of guild %s", desired.ID, p.guild.Name)
+	}
+	principal, err := p.memberPrincipal(bot)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*Change
+	for _, roleID := range desired.Roles {
+		role, err := p.provisionedRole(roleID)
+		if err != nil {
+			return nil, err
+		}
+		if contains(bot.Roles, role.ID) {
+			continue
+		}
+
+		resource, err := newRoleResource(role, p.guild)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, newChange(ChangeGrant, newRoleAssignmentEntitlement(resource, role.Name), principal))
+	}
+
+	for _, roleID := range bot.Roles {
+		role, err := p.roles.getRole(p.guild.ID, roleID)
+		if err != nil {
+			return nil, err
+		}
+		if role.Managed || !p.d.opts.roleFilter.Allows(role) || contains(desired.Roles, role.ID) {
+			continue
+		}
+
+		resource, err := newRoleResource(role, p.guild)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, newChange(ChangeRevoke, newRoleAssignmentEntitlement(resource, role.Name), principal))
+	}
+
+	return changes, nil
+}
+
+// overwriteBits are the permissions an overwrite allows and denies.
+type overwriteBits struct {
+	principal   *v2.Resource
+	allow, deny int64
+}
+
+func (p *planner) planChannel(desired *DesiredChannel, channels []*discordgo.Channel) ([]*Change, error) {
+	var channel *discordgo.Channel
+	categories := make(map[string]*discordgo.Channel)
+	for _, c := range channels {
+		if c.ID == desired.ID {
+			channel = c
+		}
+		if c.Type == discordgo.ChannelTypeGuildCategory {
+			categories[c.ID] = c
+		}
+	}
+	switch {
+	case channel == nil:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownChannel, desired.ID)
+	case !isSyncedChannelType(channel):
+		return nil, fmt.Errorf("only the overwrites of text and voice channels can be managed, not of %s", channel.Name)
+	case !p.d.opts.channelFilter.Allows(channel, categories[channel.ParentID]):
+		return nil, fmt.Errorf("channel %s is excluded by the channel filter", channel.Name)
+	}
+
+	everyone, err := p.roles.getRole(p.guild.ID, p.guild.ID)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := newChannelResource(channel, p.guild, everyone)
+	if err != nil {
+		return nil, err
+	}
+	perms := channelPermissionsFor(channel)
+
+	// Overwrites are compared by principal, in the order of the channel's overwrites and then the desired ones.
+	var keys []string
+	current := make(map[string]*overwriteBits)
+	for _, overwrite := range channel.PermissionOverwrites {
+		principal, err := p.overwritePrincipal(overwrite.Type, overwrite.ID, false)
+		if err != nil {
+			return nil, err
+		}
+		if principal == nil {
+			continue
+		}
+		key := principal.Id.ResourceType + ":" + principal.Id.Resource
+		keys = append(keys, key)
+		current[key] = &overwriteBits{principal: principal, allow: overwrite.Allow, deny: overwrite.Deny}
+	}
+
+	wanted := make(map[string]*overwriteBits)
+	for _, overwrite := range desired.Overwrites {
+		overwriteType, ok := map[string]discordgo.PermissionOverwriteType{
+			"role":   discordgo.PermissionOverwriteTypeRole,
+			"member": discordgo.PermissionOverwriteTypeMember,
+		}[overwrite.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown overwrite type %q in channel %s, expected role or member", overwrite.Type, channel.Name)
+		}
+		principal, err := p.overwritePrincipal(overwriteType, overwrite.ID, true)
+		if err != nil {
+			return nil, err
+		}
+		allow, err := permissionBits(overwrite.Allow, perms, channel)
+		if err != nil {
+			return nil, err
+		}
+		deny, err := permissionBits(overwrite.Deny, perms, channel)
+		if err != nil {
+			return nil, err
+		}
+
+		key := principal.Id.ResourceType + ":" + principal.Id.Resource
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+		wanted[key] = &overwriteBits{principal: principal, allow: allow, deny: deny}
+	}
+
+	var changes []*Change
+	for _, key := range keys {
+		// An overwrite that isn't desired is emptied, and one that doesn't exist yet starts empty.
+		have, want := current[key], wanted[key]
+		var principal *v2.Resource
+		switch {
+		case want == nil:
+			principal, want = have.principal, &overwriteBits{}
+		case have == nil:
+			principal, have = want.principal, &overwriteBits{}
+		default:
+			principal = want.principal
+		}
+
+		for _, permission := range perms {
+			changes = append(changes, bitChanges(have.allow, want.allow, permission, newChannelEntitlement(resource, permission, channel), principal)...)
+			changes = append(changes, bitChanges(have.deny, want.deny, permission, newChannelDenyEntitlement(resource, permission, channel), principal)...)
+		}
+	}
+
+	return changes, nil
+}
+
+// overwritePrincipal returns the principal of an overwrite, or nil if it is a role left out by the role filter or a
+// bot left out by the bot mode. Only desired overwrites must name a current member or role; overwrites of members who
+// have left can still be revoked.
+func (p *planner) overwritePrincipal(overwriteType discordgo.PermissionOverwriteType, id string, desired bool) (*v2.Resource, error) {
+	if overwriteType == discordgo.PermissionOverwriteTypeRole {
+		role, err := p.roles.getRole(p.guild.ID, id)
+		if err != nil {
+			return nil, err
+		}
+		if !p.d.opts.roleFilter.Allows(role) {
+			if desired {
+				return nil, fmt.Errorf("role %s is excluded by the role filter", role.Name)
+			}
+			return nil, nil
+		}
+		return newRoleResource(role, p.guild)
+	}
+
+	member, ok := p.members[id]
+	if !ok {
+		if desired {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownMember, id)
+		}
+		return &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceTypeID, Resource: id}}, nil
+	}
+	if !desired {
+		return p.d.opts.newMemberPrincipal(member, p.guild)
+	}
+	return p.memberPrincipal(member)
+}
+
+// permissionBits returns the bitmask of the named permissions, which must apply to the channel.
+func permissionBits(names []string, perms []int64, channel *discordgo.Channel) (int64, error) {
+	var bitmask int64
+	for _, name := range names {
+		permission, ok := templatePermissionValue(name)
+		if !ok {
+			return 0, fmt.Errorf("unknown permission %q", name)
+		}
+		if !contains(perms, permission) {
+			return 0, fmt.Errorf("channel %s has no entitlement for permission %s, so it can't be managed", channel.Name, name)
+		}
+		bitmask |= permission
+	}
+	return bitmask, nil
+}
+
+// bitChanges returns the change, if any, that takes the permission's bit from have to want.
+func bitChanges(have, want, permission int64, en *v2.Entitlement, principal *v2.Resource) []*Change {
+	hasBit, wantsBit := have&permission == permission, want&permission == permission
+	switch {
+	case wantsBit && !hasBit:
+		return []*Change{newChange(ChangeGrant, en, principal)}
+	case hasBit && !wantsBit:
+		return []*Change{newChange(ChangeRevoke, en, principal)}
+	default:
+		return nil
+	}
+}
+
+func sortedMembers(members map[string]*discordgo.Member) []*discordgo.Member {
+	sorted := make([]*discordgo.Member, 0, len(members))
+	for _, member := range members {
+		sorted = append(sorted, member)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return snowflake.Less(sorted[i].User.ID, sorted[j].User.ID)
+	})
+	return sorted
+}
+
+// Apply makes a single change of a plan through the provisioner of the entitlement's resource type, which acts
+// through the bot with the most permissions in the guild.
+func (d *Connector) Apply(ctx context.Context, change *Change) error {
+	var provisioner connectorbuilder.ResourceProvisioner
+	switch change.entitlement.Resource.Id.ResourceType {
+	case roleResourceTypeID:
+		provisioner = newRoleBuilder(d.conn, &d.opts)
+	case channelResourceTypeID:
+		provisioner = newChannelBuilder(d.conn, &d.opts)
+	default:
+		return fmt.Errorf("can't provision a %s", change.entitlement.Resource.Id.ResourceType)
+	}
+
+	var err error
+	if change.Action == ChangeGrant {
+		_, err = provisioner.Grant(ctx, change.principal, change.entitlement)
+	} else {
+		_, err = provisioner.Revoke(ctx, &v2.Grant{Entitlement: change.entitlement, Principal: change.principal})
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package connector_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/ConductorOne/baton-discord/pkg/connector"
+	"github.com/ConductorOne/baton-discord/pkg/fakediscord"
+)
+
+const bobID = "200000000000000002"
+
+func plan(t *testing.T, cb *connector.Connector, state *connector.DesiredState) []*connector.Change {
+	t.Helper()
+	changes, err := cb.Plan(testContext(), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changes
+}
+
+func TestApplyIsIdempotent(t *testing.T) {
+	cb, _ := newTestConnector(t, basicFixture, connector.WithBotMode(connector.BotModeSeparate))
+	state := &connector.DesiredState{
+		Version: connector.DesiredStateVersion,
+		Guild:   guildID,
+		Channels: []*connector.DesiredChannel{{
+			ID: modChannelID,
+			Overwrites: []*connector.TemplateOverwrite{
+				{Type: "role", ID: guildID, Deny: []string{"ViewChannel"}},
+				{Type: "role", ID: moderatorsID, Allow: []string{"ViewChannel", "SendMessages"}},
+			},
+		}},
+	}
+
+	changes := plan(t, cb, state)
+	if len(changes) == 0 {
+		t.Fatal("nothing was planned")
+	}
+	for _, change := range changes {
+		if err := cb.Apply(testContext(), change); err != nil {
+			t.Fatalf("%s: %v", change.Description, err)
+		}
+	}
+	if changes := plan(t, cb, state); len(changes) != 0 {
+		t.Errorf("planning again after applying yields %d changes, starting with %s", len(changes), changes[0].Description)
+	}
+
+	// The overwrites are what was applied.
+	template, err := cb.Template(testContext(), guildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, channel := range template.Channels {
+		if channel.ID != modChannelID {
+			continue
+		}
+		var got []string
+		for _, overwrite := range channel.Overwrites {
+			got = append(got, fmt.Sprintf("%s allow:%v deny:%v", overwrite.ID, overwrite.Allow, overwrite.Deny))
+		}
+		want := []string{
+			guildID + " allow:[] deny:[ViewChannel]",
+			moderatorsID + " allow:[ViewChannel SendMessages] deny:[]",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("the overwrites are %q, want %q", got, want)
+		}
+		return
+	}
+	t.Fatal("the moderators channel isn't in the template")
+}
+
+func TestPlanLeavesExcludedBotsAlone(t *testing.T) {
+	fixture, err := fakediscord.LoadFixture(basicFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, channel := range fixture.Guilds[0].Channels {
+		if channel.ID == modChannelID {
+			channel.PermissionOverwrites = append(channel.PermissionOverwrites, &discordgo.PermissionOverwrite{
+				ID:    helperBotID,
+				Type:  discordgo.PermissionOverwriteTypeMember,
+				Allow: discordgo.PermissionSendMessages,
+			})
+		}
+	}
+	cb, _ := newFixtureConnector(t, fixture, connector.WithBotMode(connector.BotModeExclude))
+
+	state := &connector.DesiredState{
+		Version: connector.DesiredStateVersion,
+		Guild:   guildID,
+		Channels: []*connector.DesiredChannel{{
+			ID: modChannelID,
+			Overwrites: []*connector.TemplateOverwrite{
+				{Type: "role", ID: guildID, Deny: []string{"ViewChannel"}},
+				{Type: "role", ID: moderatorsID, Allow: []string{"ViewChannel"}},
+				{Type: "member", ID: bobID, Allow: []string{"SendMessages"}},
+			},
+		}},
+	}
+	for _, change := range plan(t, cb, state) {
+		if strings.Contains(change.ID, helperBotID) {
+			t.Errorf("the overwrite of a bot excluded by the bot mode is changed: %s", change.Description)
+		}
+	}
+
+	state.Integrations = []*connector.DesiredIntegration{{ID: "400000000000000001", Roles: []string{}}}
+	if _, err := cb.Plan(testContext(), state); err == nil || !strings.Contains(err.Error(), "bot mode") {
+		t.Errorf("integrations were planned while bots are excluded, err = %v", err)
+	}
+}
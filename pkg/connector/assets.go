@@ -0,0 +1,164 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+// maxAssetSize is the largest asset that will be streamed from the CDN. Discord caps uploaded avatars and icons well
+// below this.
+const maxAssetSize = 10 * 1024 * 1024
+
+// assetSize is the image size requested from the CDN.
+const assetSize = 256
+
+const (
+	assetKindAvatar       = "avatar"
+	assetKindMemberAvatar = "member-avatar"
+	assetKindGuildIcon    = "guild-icon"
+	assetKindRoleIcon     = "role-icon"
+)
+
+// imageHashPattern matches the hash of an image on the CDN, which is prefixed with a_ if the image is animated.
+var imageHashPattern = regexp.MustCompile(`^(a_)?[0-9a-f]{32}$`)
+
+// snowflakePattern matches a Discord ID.
+var snowflakePattern = regexp.MustCompile(`^[0-9]{1,20}$`)
+
+// validAssetParts reports whether the IDs and image hash of an asset can safely be put in a CDN path.
+func validAssetParts(hash string, ids ...string) bool {
+	if !imageHashPattern.MatchString(hash) {
+		return false
+	}
+	for _, id := range ids {
+		if !snowflakePattern.MatchString(id) {
+			return false
+		}
+	}
+	return true
+}
+
+// newAssetRef returns an asset ref for an image on the CDN, or nil if the image hash is empty or the hash or IDs
+// aren't in the format Discord uses.
+func newAssetRef(kind string, hash string, ids ...string) *v2.AssetRef {
+	if !validAssetParts(hash, ids...) {
+		return nil
+	}
+	return &v2.AssetRef{
+		Id: strings.Join(append(append([]string{kind}, ids...), hash), ":"),
+	}
+}
+
+// memberAvatarRef prefers the guild specific avatar of a member over their user avatar.
+func memberAvatarRef(member *discordgo.Member, guildID string) *v2.AssetRef {
+	if member.Avatar != "" {
+		return newAssetRef(assetKindMemberAvatar, member.Avatar, guildID, member.User.ID)
+	}
+	return newAssetRef(assetKindAvatar, member.User.Avatar, member.User.ID)
+}
+
+// assetURL returns the CDN URL of the asset. Asset refs come back from outside the connector, so their IDs and hash are
+// validated again before they are put in the path.
+func assetURL(ref *v2.AssetRef) (string, error) {
+	parts := strings.Split(ref.Id, ":")
+	if len(parts) < 3 || !validAssetParts(parts[len(parts)-1], parts[1:len(parts)-1]...) {
+		return "", fmt.Errorf("invalid asset %q", ref.Id)
+	}
+
+	var path string
+	switch {
+	case parts[0] == assetKindAvatar && len(parts) == 3:
+		path = fmt.Sprintf("avatars/%s/%s.png", parts[1], parts[2])
+	case parts[0] == assetKindMemberAvatar && len(parts) == 4:
+		path = fmt.Sprintf("guilds/%s/users/%s/avatars/%s.png", parts[1], parts[2], parts[3])
+	case parts[0] == assetKindGuildIcon && len(parts) == 3:
+		path = fmt.Sprintf("icons/%s/%s.png", parts[1], parts[2])
+	case parts[0] == assetKindRoleIcon && len(parts) == 3:
+		path = fmt.Sprintf("role-icons/%s/%s.png", parts[1], parts[2])
+	default:
+		return "", fmt.Errorf("unknown asset %q", ref.Id)
+	}
+	return fmt.Sprintf("%s%s?size=%d", discordgo.EndpointCDN, path, assetSize), nil
+}
+
+// fetchAsset streams an image from the CDN, refusing anything that isn't an image or exceeds maxAssetSize.
+func fetchAsset(ctx context.Context, client *http.Client, ref *v2.AssetRef) (string, io.ReadCloser, error) {
+	url, err := assetURL(ref)
+	if err != nil {
+		return "", nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return "", nil, fmt.Errorf("unexpected status fetching asset %s: %s", ref.Id, resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		resp.Body.Close()
+		return "", nil, fmt.Errorf("unexpected content type %q for asset %s", contentType, ref.Id)
+	}
+
+	if resp.ContentLength > maxAssetSize {
+		resp.Body.Close()
+		return "", nil, fmt.Errorf("asset %s is too large: %d bytes", ref.Id, resp.ContentLength)
+	}
+
+	return contentType, &limitedReadCloser{
+		Reader: io.LimitReader(resp.Body, maxAssetSize),
+		Closer: resp.Body,
+	}, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// guildRoles returns the roles of a guild along with the icon hash of every role that has one, from a single request.
+// discordgo doesn't decode role icons.
+func guildRoles(s *discordgo.Session, guildID string) ([]*discordgo.Role, map[string]string, error) {
+	body, err := s.RequestWithBucketID("GET", discordgo.EndpointGuildRoles(guildID), nil, discordgo.EndpointGuildRoles(guildID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var roles []*discordgo.Role
+	if err := json.Unmarshal(body, &roles); err != nil {
+		return nil, nil, err
+	}
+
+	var roleIcons []struct {
+		ID   string `json:"id"`
+		Icon string `json:"icon"`
+	}
+	if err := json.Unmarshal(body, &roleIcons); err != nil {
+		return nil, nil, err
+	}
+
+	icons := make(map[string]string)
+	for _, role := range roleIcons {
+		if role.Icon != "" {
+			icons[role.ID] = role.Icon
+		}
+	}
+	return roles, icons, nil
+}
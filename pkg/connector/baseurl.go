@@ -0,0 +1,52 @@
+package connector
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// baseURLTransport sends the requests discordgo makes to the Discord API to another server instead, such as a proxy
+// or a fake API. discordgo's endpoints are package variables, so they are rewritten per request rather than changed.
+type baseURLTransport struct {
+	next    http.RoundTripper
+	discord *url.URL
+	base    *url.URL
+}
+
+func newBaseURLTransport(next http.RoundTripper, baseURL string) (*baseURLTransport, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL %q: %w", baseURL, err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: must be an absolute http or https URL", baseURL)
+	}
+
+	discord, err := url.Parse(discordgo.EndpointDiscord)
+	if err != nil {
+		return nil, err
+	}
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &baseURLTransport{next: next, discord: discord, base: base}, nil
+}
+
+func (t *baseURLTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.discord.Host {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.base.Scheme
+	req.URL.Host = t.base.Host
+	req.URL.Path = strings.TrimSuffix(t.base.Path, "/") + req.URL.Path
+	req.URL.RawPath = ""
+	req.Host = ""
+	return t.next.RoundTrip(req)
+}
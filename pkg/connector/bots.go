@@ -0,0 +1,265 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	resource_sdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+// BotMode controls how bot accounts are synced.
+type BotMode string
+
+const (
+	// BotModeUser syncs bots as users with a service account type.
+	BotModeUser BotMode = "user"
+	// BotModeExclude leaves bots out of the sync entirely.
+	BotModeExclude BotMode = "exclude"
+	// BotModeSeparate syncs bots as their own resource type.
+	BotModeSeparate BotMode = "separate"
+)
+
+// ParseBotMode returns the BotMode for the given name. An empty name is the default, BotModeUser.
+func ParseBotMode(name string) (BotMode, error) {
+	switch mode := BotMode(name); mode {
+	case "":
+		return BotModeUser, nil
+	case BotModeUser, BotModeExclude, BotModeSeparate:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown bot mode %q", name)
+	}
+}
+
+var botResourceType = resource_sdk.NewResourceType(
+	"Bot",
+	[]v2.ResourceType_Trait{v2.ResourceType_TRAIT_USER},
+	&v2.SkipEntitlementsAndGrants{},
+)
+
+type botBuilder struct {
+	conn *sessions
+	*syncOptions
+}
+
+// botIntegration is a guild integration, including the application that discordgo doesn't decode.
+type botIntegration struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Application *struct {
+		ID   string          `json:"id"`
+		Name string          `json:"name"`
+		Bot  *discordgo.User `json:"bot"`
+	} `json:"application"`
+}
+
+func newBotResource(member *discordgo.Member, guild *discordgo.Guild, globalName string, integration *botIntegration, administrator bool) (*v2.Resource, error) {
+	guildResource, err := resource_sdk.NewResourceID(guildResourceType, guild.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := memberProfile(member, globalName)
+	profile["administrator"] = administrator
+	if integration != nil {
+		profile["integration_id"] = integration.ID
+		profile["integration_name"] = integration.Name
+		if integration.Application != nil {
+			profile["application_id"] = integration.Application.ID
+			profile["application_name"] = integration.Application.Name
+		}
+	}
+
+	name := member.Nick
+	if name == "" {
+		name = member.User.Username
+	}
+
+	options := []resource_sdk.UserTraitOption{
+		resource_sdk.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE),
+		resource_sdk.WithUserLogin(member.User.Username),
+		resource_sdk.WithUserProfile(profile),
+		withMemberStatus(member, time.Now()),
+	}
+	if icon := memberAvatarRef(member, guild.ID); icon != nil {
+		options = append(options, resource_sdk.WithUserIcon(icon))
+	}
+
+	return resource_sdk.NewUserResource(
+		name,
+		botResourceType,
+		member.User.ID,
+		options,
+		resource_sdk.WithParentResourceID(guildResource),
+		withExternalLink("users", member.User.ID),
+	)
+}
+
+// newMemberPrincipal returns the resource used as the principal of grants to the member, or nil if the member is
+// excluded from the sync.
+func (o *syncOptions) newMemberPrincipal(member *discordgo.Member, guild *discordgo.Guild) (*v2.Resource, error) {
+	if member.User.Bot {
+		switch o.botMode {
+		case BotModeExclude:
+			return nil, nil
+		case BotModeSeparate:
+			return newBotResource(member, guild, "", nil, false)
+		case BotModeUser:
+		}
+	}
+
+	return newMemberResource(member, guild, "")
+}
+
+// includesMember reports whether the member is synced as a user.
+func (o *syncOptions) includesMember(member *discordgo.Member) bool {
+	return !member.User.Bot || o.botMode == "" || o.botMode == BotModeUser
+}
+
+func (o *botBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return botResourceType
+}
+
+func (o *botBuilder) integrations(guildID string) (map[string]*botIntegration, error) {
+	body, err := o.conn.forGuild(guildID).RequestWithBucketID(
+		"GET",
+		discordgo.EndpointGuildIntegrations(guildID),
+		nil,
+		discordgo.EndpointGuildIntegrations(guildID),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var integrations []*botIntegration
+	if err := json.Unmarshal(body, &integrations); err != nil {
+		return nil, err
+	}
+
+	byBot := make(map[string]*botIntegration)
+	for _, integration := range integrations {
+		if integration.Application == nil || integration.Application.Bot == nil {
+			continue
+		}
+		byBot[integration.Application.Bot.ID] = integration
+	}
+	return byBot, nil
+}
+
+// List returns the bots of every guild. Bots holding the Administrator permission are also reported in the response
+// annotations.
+func (o *botBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	perGuild, err := mapGuilds(ctx, o.syncOptions, o.conn, func(guild *discordgo.Guild) (guildBots, error) {
+		return o.listGuild(ctx, guild)
+	})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	resources := []*v2.Resource{}
+	administratorBots := []interface{}{}
+	for _, guildBots := range perGuild {
+		resources = append(resources, guildBots.resources...)
+		administratorBots = append(administratorBots, guildBots.administratorBots...)
+	}
+
+	annos := o.annotations()
+	if len(administratorBots) > 0 {
+		report, err := newReport("administrator_bots", administratorBots)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		annos.Append(report)
+	}
+
+	return resources, "", annos, nil
+}
+
+// guildBots are the bots of a single guild.
+type guildBots struct {
+	resources         []*v2.Resource
+	administratorBots []interface{}
+}
+
+func (o *botBuilder) listGuild(ctx context.Context, guild *discordgo.Guild) (guildBots, error) {
+	var bots guildBots
+
+	roles, err := o.conn.forGuild(guild.ID).GuildRoles(guild.ID)
+	if err != nil {
+		return bots, err
+	}
+	permsByRole := make(map[string]int64)
+	for _, role := range roles {
+		permsByRole[role.ID] = role.Permissions
+	}
+
+	// Listing integrations needs the Manage Server permission. Without it, bots are synced without their integration.
+	integrations, err := o.integrations(guild.ID)
+	if err != nil {
+		if !o.skip(ctx, "integrations", guild.ID, err) {
+			return bots, err
+		}
+		integrations = map[string]*botIntegration{}
+	}
+
+	nextPageToken := ""
+	for {
+		members, globalNames, err := guildMembers(o.conn.forGuild(guild.ID), guild.ID, nextPageToken, 1000)
+		if err != nil {
+			return bots, err
+		}
+		if len(members) == 0 {
+			break
+		}
+
+		for _, member := range members {
+			if !member.User.Bot {
+				continue
+			}
+
+			perms := permsByRole[guild.ID]
+			for _, roleID := range member.Roles {
+				perms |= permsByRole[roleID]
+			}
+			administrator := perms&discordgo.PermissionAdministrator == discordgo.PermissionAdministrator
+
+			resource, err := newBotResource(member, guild, globalNames[member.User.ID], integrations[member.User.ID], administrator)
+			if err != nil {
+				return bots, err
+			}
+			bots.resources = append(bots.resources, resource)
+
+			if administrator {
+				bots.administratorBots = append(bots.administratorBots, map[string]interface{}{
+					"guild_id": guild.ID,
+					"bot_id":   member.User.ID,
+					"name":     resource.DisplayName,
+				})
+			}
+		}
+		nextPageToken = members[len(members)-1].User.ID
+	}
+
+	return bots, nil
+}
+
+// Entitlements always returns an empty slice for bots.
+func (o *botBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", o.annotations(), nil
+}
+
+// Grants always returns an empty slice for bots since they don't have any entitlements.
+func (o *botBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", o.annotations(), nil
+}
+
+func newBotBuilder(s *sessions, opts *syncOptions) *botBuilder {
+	return &botBuilder{conn: s, syncOptions: opts}
+}
@@ -2,8 +2,8 @@ package connector
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
@@ -22,8 +22,12 @@ var channelResourceType = &v2.ResourceType{
 }
 
 type channelBuilder struct {
-	conn *discordgo.Session
+	conn *sessions
+	*syncOptions
 
+	// cacheMtx guards the caches, which are filled while guilds are listed concurrently. It is never held while a
+	// guild is fetched, so that guilds don't wait on each other; two lookups in the same guild may both fetch it.
+	cacheMtx     sync.Mutex
 	memberCache  map[string]map[string]*discordgo.Member
 	roleCache    map[string]map[string]*discordgo.Role
 	channelCache map[string]map[string]*discordgo.Channel
@@ -33,91 +37,149 @@ func (o *channelBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 	return channelResourceType
 }
 
-func newChannelResource(channel *discordgo.Channel, guild *discordgo.Guild) (*v2.Resource, error) {
+func newChannelResource(channel *discordgo.Channel, guild *discordgo.Guild, everyone *discordgo.Role) (*v2.Resource, error) {
 	guildResource, err := resource_sdk.NewResourceID(guildResourceType, guild.ID)
 	if err != nil {
 		return nil, err
 	}
 
+	visibility := "restricted"
+	if isPublicToGuild(everyone, channel) {
+		visibility = "public to guild"
+	}
+
 	return resource_sdk.NewResource(
 		channel.Name,
 		channelResourceType,
 		channel.ID,
 		resource_sdk.WithParentResourceID(guildResource),
 		resource_sdk.WithDescription(channel.Topic),
+		withExternalLink("channels", guild.ID, channel.ID),
+		withProfile(map[string]interface{}{
+			"visibility": visibility,
+		}),
 	)
 }
 
 // List returns all the guilds from the database as resource objects.
 func (o *channelBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	resources, err := listGuildResources(ctx, o.syncOptions, o.conn, o.listGuild)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return resources, "", o.annotations(), nil
+}
+
+func (o *channelBuilder) listGuild(guild *discordgo.Guild) ([]*v2.Resource, error) {
 	resources := []*v2.Resource{}
 
-	for _, guild := range o.conn.State.Guilds {
-		channels, err := o.conn.GuildChannels(guild.ID)
-		if err != nil {
-			return nil, "", nil, err
+	channels, err := o.conn.forGuild(guild.ID).GuildChannels(guild.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	everyone, err := o.getRole(guild.ID, guild.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := make(map[string]*discordgo.Channel)
+	for _, channel := range channels {
+		if channel.Type == discordgo.ChannelTypeGuildCategory {
+			categories[channel.ID] = channel
 		}
+	}
 
-		for _, channel := range channels {
-			// Skip channels that aren't one of these
-			if channel.Type != discordgo.ChannelTypeGuildText && channel.Type != discordgo.ChannelTypeGuildVoice {
-				continue
-			}
+	for _, channel := range channels {
+		if !isSyncedChannelType(channel) {
+			continue
+		}
 
-			channel, err := newChannelResource(channel, guild)
-			if err != nil {
-				return nil, "", nil, err
-			}
-			resources = append(resources, channel)
+		if !o.channelFilter.Allows(channel, categories[channel.ParentID]) {
+			continue
 		}
+
+		channel, err := newChannelResource(channel, guild, everyone)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, channel)
 	}
 
-	return resources, "", nil, nil
+	return resources, nil
 }
 
-func newChannelEntitlement(resource *v2.Resource, permission int64, channel *discordgo.Channel) *v2.Entitlement {
+// isSyncedChannelType reports whether channels of this type are synced. Categories, threads and stage channels aren't.
+func isSyncedChannelType(channel *discordgo.Channel) bool {
+	return channel.Type == discordgo.ChannelTypeGuildText || channel.Type == discordgo.ChannelTypeGuildVoice
+}
+
+func newChannelEntitlement(resource *v2.Resource, permission int64, channel *discordgo.Channel, opts ...entitlement.EntitlementOption) *v2.Entitlement {
 	return entitlement.NewPermissionEntitlement(
 		resource,
 		fmt.Sprintf("%s for %s", permNameFromVal[permission], channel.Name),
-		entitlement.WithGrantableTo(userResourceType),
-		entitlement.WithGrantableTo(roleResourceType),
+		append([]entitlement.EntitlementOption{
+			entitlement.WithGrantableTo(userResourceType, roleResourceType),
+			withPermissionMetadata(permission),
+		}, opts...)...,
+	)
+}
+
+// newChannelDenyEntitlement represents an explicit deny of a permission by a channel overwrite.
+func newChannelDenyEntitlement(resource *v2.Resource, permission int64, channel *discordgo.Channel, opts ...entitlement.EntitlementOption) *v2.Entitlement {
+	return entitlement.NewPermissionEntitlement(
+		resource,
+		fmt.Sprintf("Denied %s for %s", permNameFromVal[permission], channel.Name),
+		append([]entitlement.EntitlementOption{
+			entitlement.WithGrantableTo(userResourceType, roleResourceType),
+			withPermissionMetadata(permission),
+		}, opts...)...,
 	)
 }
 
-func (o *channelBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+// channelPermissionsFor returns the permissions that apply to the type of the channel.
+func channelPermissionsFor(channel *discordgo.Channel) []int64 {
+	if channel.Type == discordgo.ChannelTypeGuildVoice {
+		return channelPermissions
+	}
+	return textChannelPermissions
+}
+
+func (o *channelBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
 	entitlements := []*v2.Entitlement{}
 
-	channel, err := o.conn.Channel(resource.Id.Resource)
+	channel, err := o.conn.forGuild(resource.ParentResourceId.Resource).Channel(resource.Id.Resource)
 	if err != nil {
+		if o.skip(ctx, channelResourceTypeID, resource.Id.Resource, err) {
+			return nil, "", o.annotations(), nil
+		}
 		return nil, "", nil, err
 	}
 
-	perms := textChannelPermissions
-	if channel.Type == discordgo.ChannelTypeGuildVoice {
-		perms = channelPermissions
+	perms := channelPermissionsFor(channel)
+	for _, permission := range perms {
+		entitlements = append(
+			entitlements,
+			newChannelEntitlement(resource, permission, channel, o.grantableToMembers(roleResourceType)),
+		)
 	}
-
 	for _, permission := range perms {
 		entitlements = append(
 			entitlements,
-			newChannelEntitlement(resource, permission, channel),
+			newChannelDenyEntitlement(resource, permission, channel, o.grantableToMembers(roleResourceType)),
 		)
 	}
 
-	return entitlements, "", nil, nil
+	return entitlements, "", o.annotations(), nil
 }
 
-func newChannelUserPermissionGrant(resource *v2.Resource, guild *discordgo.Guild, user *discordgo.Member, channel *discordgo.Channel, permission int64) (*v2.Grant, error) {
-	userPrincipal, err := newMemberResource(user, guild)
-	if err != nil {
-		return nil, err
-	}
-
+func newChannelUserPermissionGrant(resource *v2.Resource, userPrincipal *v2.Resource, channel *discordgo.Channel, permission int64) *v2.Grant {
 	return grant.NewGrant(
 		resource,
 		newChannelEntitlement(resource, permission, channel).DisplayName,
 		userPrincipal,
-	), nil
+	)
 }
 func newChannelRolePermissionGrant(resource *v2.Resource, guild *discordgo.Guild, role *discordgo.Role, channel *discordgo.Channel, permission int64) (*v2.Grant, error) {
 	rolePrincipal, err := newRoleResource(role, guild)
@@ -133,40 +195,49 @@ func newChannelRolePermissionGrant(resource *v2.Resource, guild *discordgo.Guild
 }
 
 func (c *channelBuilder) getChannel(guildID string, channelID string) (*discordgo.Channel, error) {
+	if err := c.guildFilter.checkGuildID(c.conn, guildID); err != nil {
+		return nil, err
+	}
+
+	c.cacheMtx.Lock()
 	channelCache, ok := c.channelCache[guildID]
+	c.cacheMtx.Unlock()
 	if !ok {
-		channelCache = make(map[string]*discordgo.Channel)
-		c.channelCache[guildID] = channelCache
-
-		guildChannels, err := c.conn.GuildChannels(guildID)
+		guildChannels, err := c.conn.forGuild(guildID).GuildChannels(guildID)
 		if err != nil {
-			return nil, err
+			return nil, classifyError(err)
 		}
 
+		channelCache = make(map[string]*discordgo.Channel)
 		for _, channel := range guildChannels {
 			channelCache[channel.ID] = channel
 		}
+
+		c.cacheMtx.Lock()
+		c.channelCache[guildID] = channelCache
+		c.cacheMtx.Unlock()
 	}
 
 	channel, ok := channelCache[channelID]
 	if !ok {
-		return nil, errors.New("channel not found")
+		return nil, fmt.Errorf("%w: %s", ErrUnknownChannel, channelID)
 	}
 
 	return channel, nil
 }
 
 func (c *channelBuilder) getMember(guildID string, memberID string) (*discordgo.Member, error) {
+	c.cacheMtx.Lock()
 	userCache, ok := c.memberCache[guildID]
+	c.cacheMtx.Unlock()
 	if !ok {
 		userCache = make(map[string]*discordgo.Member)
-		c.memberCache[guildID] = userCache
 
 		token := ""
 		for {
-			guildMembers, err := c.conn.GuildMembers(guildID, token, 1000)
+			guildMembers, err := c.conn.forGuild(guildID).GuildMembers(guildID, token, 1000)
 			if err != nil {
-				return nil, err
+				return nil, classifyError(err)
 			}
 
 			if len(guildMembers) == 0 {
@@ -179,34 +250,46 @@ func (c *channelBuilder) getMember(guildID string, memberID string) (*discordgo.
 
 			token = guildMembers[len(guildMembers)-1].User.ID
 		}
+
+		c.cacheMtx.Lock()
+		c.memberCache[guildID] = userCache
+		c.cacheMtx.Unlock()
 	}
 
 	user, ok := userCache[memberID]
 	if !ok {
-		return nil, errors.New("member not found")
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMember, memberID)
 	}
 
 	return user, nil
 }
 func (c *channelBuilder) getRole(guildID string, roleID string) (*discordgo.Role, error) {
+	if err := c.guildFilter.checkGuildID(c.conn, guildID); err != nil {
+		return nil, err
+	}
+
+	c.cacheMtx.Lock()
 	roleCache, ok := c.roleCache[guildID]
+	c.cacheMtx.Unlock()
 	if !ok {
-		roleCache = make(map[string]*discordgo.Role)
-		c.roleCache[guildID] = roleCache
-
-		guildRoles, err := c.conn.GuildRoles(guildID)
+		guildRoles, err := c.conn.forGuild(guildID).GuildRoles(guildID)
 		if err != nil {
-			return nil, err
+			return nil, classifyError(err)
 		}
 
+		roleCache = make(map[string]*discordgo.Role)
 		for _, role := range guildRoles {
 			roleCache[role.ID] = role
 		}
+
+		c.cacheMtx.Lock()
+		c.roleCache[guildID] = roleCache
+		c.cacheMtx.Unlock()
 	}
 
 	role, ok := roleCache[roleID]
 	if !ok {
-		return nil, errors.New("role not found")
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRole, roleID)
 	}
 
 	return role, nil
@@ -215,33 +298,120 @@ func (c *channelBuilder) getRole(guildID string, roleID string) (*discordgo.Role
 func (c *channelBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
 	var grants []*v2.Grant
 
-	guild, err := c.conn.Guild(resource.ParentResourceId.Resource)
+	guild, err := c.conn.forGuild(resource.ParentResourceId.Resource).Guild(resource.ParentResourceId.Resource)
 	if err != nil {
+		if c.skip(ctx, guildResourceTypeID, resource.ParentResourceId.Resource, err) {
+			return nil, "", c.annotations(), nil
+		}
 		return nil, "", nil, err
 	}
 
 	channel, err := c.getChannel(guild.ID, resource.Id.Resource)
 	if err != nil {
+		if c.skip(ctx, channelResourceTypeID, resource.Id.Resource, err) {
+			return nil, "", c.annotations(), nil
+		}
 		return nil, "", nil, err
 	}
 	for _, permissionOverride := range channel.PermissionOverwrites {
-		switch permissionOverride.Type {
-		case discordgo.PermissionOverwriteTypeMember:
-			memberGrants, err := c.getChannelGrantForMember(resource, guild, channel, permissionOverride)
-			if err != nil {
-				return nil, "", nil, err
-			}
-			grants = append(grants, memberGrants...)
-		case discordgo.PermissionOverwriteTypeRole:
-			roleGrants, err := c.getChannelGrantForRole(resource, guild, channel, permissionOverride)
-			if err != nil {
-				return nil, "", nil, err
+		overwriteGrants, err := c.getChannelOverwriteGrants(resource, guild, channel, permissionOverride)
+		if err != nil {
+			// The overwrite may name a member who has since left, or a role that has been deleted.
+			if c.skip(ctx, overwriteResourceTypeID(permissionOverride), permissionOverride.ID, err) {
+				continue
 			}
-			grants = append(grants, roleGrants...)
+			return nil, "", nil, err
 		}
+		grants = append(grants, overwriteGrants...)
 	}
 
-	return grants, "", nil, nil
+	return grants, "", c.annotations(), nil
+}
+
+// getChannelOverwriteGrants returns the grants from a single permission overwrite of the channel.
+func (c *channelBuilder) getChannelOverwriteGrants(resource *v2.Resource, guild *discordgo.Guild, channel *discordgo.Channel, overwrite *discordgo.PermissionOverwrite) ([]*v2.Grant, error) {
+	grants, err := c.getChannelDenyGrants(resource, guild, channel, overwrite)
+	if err != nil {
+		return nil, err
+	}
+
+	switch overwrite.Type {
+	case discordgo.PermissionOverwriteTypeMember:
+		memberGrants, err := c.getChannelGrantForMember(resource, guild, channel, overwrite)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, memberGrants...)
+	case discordgo.PermissionOverwriteTypeRole:
+		roleGrants, err := c.getChannelGrantForRole(resource, guild, channel, overwrite)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, roleGrants...)
+	}
+	return grants, nil
+}
+
+// overwriteResourceTypeID returns the resource type of the principal of the overwrite.
+func overwriteResourceTypeID(overwrite *discordgo.PermissionOverwrite) string {
+	if overwrite.Type == discordgo.PermissionOverwriteTypeRole {
+		return roleResourceTypeID
+	}
+	return userResourceTypeID
+}
+
+// getChannelDenyGrants returns a grant for every permission the overwrite explicitly denies.
+func (c *channelBuilder) getChannelDenyGrants(resource *v2.Resource, guild *discordgo.Guild, channel *discordgo.Channel, overwrite *discordgo.PermissionOverwrite) ([]*v2.Grant, error) {
+	var grants []*v2.Grant
+	if overwrite.Deny == 0 {
+		return nil, nil
+	}
+
+	var principal *v2.Resource
+	switch overwrite.Type {
+	case discordgo.PermissionOverwriteTypeMember:
+		member, err := c.getMember(guild.ID, overwrite.ID)
+		if err != nil {
+			return nil, err
+		}
+		principal, err = c.newMemberPrincipal(member, guild)
+		if err != nil {
+			return nil, err
+		}
+		if principal == nil {
+			return nil, nil
+		}
+	case discordgo.PermissionOverwriteTypeRole:
+		role, err := c.getRole(guild.ID, overwrite.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !c.roleFilter.Allows(role) {
+			return nil, nil
+		}
+		principal, err = newRoleResource(role, guild)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	for _, channelPerm := range channelPermissionsFor(channel) {
+		if overwrite.Deny&channelPerm != channelPerm {
+			continue
+		}
+
+		grants = append(grants, grant.NewGrant(
+			resource,
+			newChannelDenyEntitlement(resource, channelPerm, channel).DisplayName,
+			principal,
+			grant.WithGrantMetadata(map[string]interface{}{
+				"overwrite": "deny",
+			}),
+		))
+	}
+	return grants, nil
 }
 
 func (c *channelBuilder) getChannelGrantForRole(resource *v2.Resource, guild *discordgo.Guild, channel *discordgo.Channel, permission *discordgo.PermissionOverwrite) ([]*v2.Grant, error) {
@@ -250,6 +420,9 @@ func (c *channelBuilder) getChannelGrantForRole(resource *v2.Resource, guild *di
 	if err != nil {
 		return nil, err
 	}
+	if !c.roleFilter.Allows(role) {
+		return nil, nil
+	}
 
 	for _, channelPerm := range channelPermissions {
 		if role.Permissions&channelPerm != channelPerm {
@@ -271,30 +444,139 @@ func (c *channelBuilder) getChannelGrantForMember(resource *v2.Resource, guild *
 	if err != nil {
 		return nil, err
 	}
-	userPermissionsBitmask, err := c.conn.UserChannelPermissions(member.User.ID, channel.ID)
+	userPrincipal, err := c.newMemberPrincipal(member, guild)
 	if err != nil {
 		return nil, err
 	}
+	if userPrincipal == nil {
+		return nil, nil
+	}
+	userPermissionsBitmask, err := c.conn.forGuild(guild.ID).UserChannelPermissions(member.User.ID, channel.ID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
 	for _, channelPerm := range channelPermissions {
 		if userPermissionsBitmask&channelPerm != channelPerm {
 			continue
 		}
 
-		grant, err := newChannelUserPermissionGrant(resource, guild, member, channel, channelPerm)
-		if err != nil {
-			return nil, err
-		}
-
-		grants = append(grants, grant)
+		grants = append(grants, newChannelUserPermissionGrant(resource, userPrincipal, channel, channelPerm))
 	}
 	return grants, nil
 }
 
-func newChannelBuilder(s *discordgo.Session) *channelBuilder {
+func newChannelBuilder(s *sessions, opts *syncOptions) *channelBuilder {
 	return &channelBuilder{
 		conn:         s,
+		syncOptions:  opts,
 		memberCache:  make(map[string]map[string]*discordgo.Member),
 		roleCache:    make(map[string]map[string]*discordgo.Role),
 		channelCache: make(map[string]map[string]*discordgo.Channel),
 	}
 }
+
+// overwritePermission returns the permission of a channel entitlement, and whether the entitlement is its explicit
+// deny.
+func overwritePermission(en *v2.Entitlement, channel *discordgo.Channel) (int64, bool, error) {
+	for _, permission := range channelPermissionsFor(channel) {
+		if en.Id == newChannelEntitlement(en.Resource, permission, channel).Id {
+			return permission, false, nil
+		}
+		if en.Id == newChannelDenyEntitlement(en.Resource, permission, channel).Id {
+			return permission, true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("unknown entitlement %s of channel %s", en.Id, channel.Name)
+}
+
+// overwriteType returns the type of the overwrite for the principal.
+func overwriteType(principal *v2.Resource) (discordgo.PermissionOverwriteType, error) {
+	switch principal.Id.ResourceType {
+	case roleResourceTypeID:
+		return discordgo.PermissionOverwriteTypeRole, nil
+	case userResourceTypeID, botResourceType.Id:
+		return discordgo.PermissionOverwriteTypeMember, nil
+	default:
+		return 0, fmt.Errorf("a %s can't have a channel permission overwrite", principal.Id.ResourceType)
+	}
+}
+
+// setOverwrite sets or clears the bit of the entitlement's permission in the principal's overwrite of the channel.
+// Allowing a permission clears its deny and the other way around, and an overwrite left empty is deleted. The
+// channel is read again first, so that changes made since it was cached aren't lost, and nothing is sent if the bit
+// is already as requested.
+func (c *channelBuilder) setOverwrite(en *v2.Entitlement, principal *v2.Resource, set bool) error {
+	targetType, err := overwriteType(principal)
+	if err != nil {
+		return err
+	}
+
+	channelID := en.Resource.Id.Resource
+	channel, err := c.conn.channel(channelID)
+	if err != nil {
+		return classifyError(err)
+	}
+	if err := c.guildFilter.checkGuildID(c.conn, channel.GuildID); err != nil {
+		return err
+	}
+
+	permission, deny, err := overwritePermission(en, channel)
+	if err != nil {
+		return err
+	}
+
+	var allowBits, denyBits int64
+	for _, overwrite := range channel.PermissionOverwrites {
+		if overwrite.ID == principal.Id.Resource && overwrite.Type == targetType {
+			allowBits, denyBits = overwrite.Allow, overwrite.Deny
+		}
+	}
+
+	newAllow, newDeny := allowBits, denyBits
+	switch {
+	case set && deny:
+		newDeny |= permission
+		newAllow &^= permission
+	case set:
+		newAllow |= permission
+		newDeny &^= permission
+	case deny:
+		newDeny &^= permission
+	default:
+		newAllow &^= permission
+	}
+	if newAllow == allowBits && newDeny == denyBits {
+		return nil
+	}
+
+	s := c.conn.forGuild(channel.GuildID)
+	if newAllow == 0 && newDeny == 0 {
+		err = s.ChannelPermissionDelete(channel.ID, principal.Id.Resource)
+	} else {
+		err = s.ChannelPermissionSet(channel.ID, principal.Id.Resource, targetType, newAllow, newDeny)
+	}
+	if err != nil {
+		return classifyError(err)
+	}
+
+	c.cacheMtx.Lock()
+	defer c.cacheMtx.Unlock()
+	delete(c.channelCache, channel.GuildID)
+	return nil
+}
+
+// Grant allows or explicitly denies the entitlement's permission to the principal in the channel's overwrites.
+func (c *channelBuilder) Grant(ctx context.Context, principal *v2.Resource, en *v2.Entitlement) (annotations.Annotations, error) {
+	if err := c.setOverwrite(en, principal, true); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// Revoke removes the grant's permission from the allowed or denied permissions of the principal's overwrite.
+func (c *channelBuilder) Revoke(ctx context.Context, g *v2.Grant) (annotations.Annotations, error) {
+	if err := c.setOverwrite(g.Entitlement, g.Principal, false); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
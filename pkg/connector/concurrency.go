@@ -0,0 +1,61 @@
+package connector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+// defaultGuildConcurrency is the number of guilds fetched at once when no concurrency is configured. Discord's global
+// and per-route limits are enforced by the session's rate limiter regardless of how many guilds are in flight.
+const defaultGuildConcurrency = 4
+
+// mapGuilds calls fn for every synced guild, with at most guildConcurrency calls in flight, and returns the results in
+// the order of the guilds so that output is stable across runs. Guilds that turn out to be inaccessible are skipped
+// with their zero value; otherwise the first error encountered is returned.
+func mapGuilds[T any](ctx context.Context, o *syncOptions, s *sessions, fn func(guild *discordgo.Guild) (T, error)) ([]T, error) {
+	guilds := o.guildFilter.guilds(s.guilds())
+	results := make([]T, len(guilds))
+	errs := make([]error, len(guilds))
+
+	concurrency := o.guildConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultGuildConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, guild := range guilds {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, guild *discordgo.Guild) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = fn(guild)
+		}(i, guild)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil && !o.skip(ctx, guildResourceTypeID, guilds[i].ID, err) {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// listGuildResources is mapGuilds for the common case of listing resources, flattening the per-guild results.
+func listGuildResources(ctx context.Context, o *syncOptions, s *sessions, fn func(guild *discordgo.Guild) ([]*v2.Resource, error)) ([]*v2.Resource, error) {
+	perGuild, err := mapGuilds(ctx, o, s, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []*v2.Resource{}
+	for _, guildResources := range perGuild {
+		resources = append(resources, guildResources...)
+	}
+	return resources, nil
+}
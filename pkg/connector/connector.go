@@ -2,41 +2,69 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type Connector struct {
-	conn *discordgo.Session
+	conn *sessions
+
+	opts syncOptions
 }
 
 // ResourceSyncers returns a ResourceSyncer for each resource type that should be synced from the upstream service.
 func (d *Connector) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
-	return []connectorbuilder.ResourceSyncer{
-		newUserBuilder(d.conn),
-		newGuildBuilder(d.conn),
-		newRoleBuilder(d.conn),
-		newChannelBuilder(d.conn),
+	syncers := []connectorbuilder.ResourceSyncer{
+		newUserBuilder(d.conn, &d.opts),
+		newGuildBuilder(d.conn, &d.opts),
+		newRoleBuilder(d.conn, &d.opts),
+		newChannelBuilder(d.conn, &d.opts),
+		newScheduledEventBuilder(d.conn, &d.opts),
+		newEmojiBuilder(d.conn, &d.opts),
+		newStickerBuilder(d.conn, &d.opts),
+	}
+	if d.opts.botMode == BotModeSeparate {
+		syncers = append(syncers, newBotBuilder(d.conn, &d.opts))
 	}
+	return syncers
 }
 
 // Asset takes an input AssetRef and attempts to fetch it using the connector's authenticated http client
 // It streams a response, always starting with a metadata object, following by chunked payloads for the asset.
 func (d *Connector) Asset(ctx context.Context, asset *v2.AssetRef) (string, io.ReadCloser, error) {
-	return "", nil, nil
+	return fetchAsset(ctx, d.conn.any().Client, asset)
 }
 
 // Metadata returns metadata about the connector.
 func (d *Connector) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error) {
+	// Record the effective filters so that a sync can be told apart from a full one.
+	profile, err := structpb.NewStruct(map[string]interface{}{
+		"guild_filter":      d.opts.guildFilter.profile(),
+		"channel_filter":    d.opts.channelFilter.profile(),
+		"role_filter":       d.opts.roleFilter.profile(),
+		"bot_mode":          string(d.opts.botMode),
+		"bots":              stringsToValues(d.conn.names()),
+		"guild_concurrency": d.opts.guildConcurrency,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return &v2.ConnectorMetadata{
 		DisplayName: "Discord Baton Connector",
 		Description: "An implementation of a Discord connector using Baton.",
+		Profile:     profile,
 	}, nil
 }
 
@@ -46,17 +74,135 @@ func (d *Connector) Validate(ctx context.Context) (annotations.Annotations, erro
 	return nil, nil
 }
 
-// New returns a new instance of the connector.
-func New(ctx context.Context, token string) (*Connector, error) {
-	dcConn, err := discordgo.New(fmt.Sprintf("Bot %s", token))
+// New returns a new instance of the connector. The token is that of the default bot, unless it is read from a
+// TokenSource; more bots can be added with WithBotToken, in which case the token may be empty.
+func New(ctx context.Context, token string, opts ...Option) (*Connector, error) {
+	c := &Connector{}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+
+	tokens := c.opts.botTokens
+	switch {
+	case token != "":
+		tokens = append([]botToken{{name: defaultBotName, source: staticToken(token)}}, tokens...)
+	case c.opts.tokenSource != nil:
+		tokens = append([]botToken{{name: defaultBotName, source: c.opts.tokenSource}}, tokens...)
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("no bot token configured")
+	}
+
+	tlsConfig, err := c.opts.tlsConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	dcConn.Identify.Intents = discordgo.IntentsAllWithoutPrivileged | discordgo.IntentGuildMembers
-	if err := dcConn.Open(); err != nil {
+	// Every session shares the client. Authorization is set per request, and discordgo keeps its own rate limit
+	// buckets per session.
+	client, err := c.opts.newHTTPClient(ctx, tlsConfig)
+	if err != nil {
 		return nil, err
 	}
+	if c.opts.baseURL != "" {
+		transport, err := newBaseURLTransport(client.Transport, c.opts.baseURL)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+	}
+	if c.opts.transport != nil {
+		client.Transport = c.opts.transport(client.Transport)
+	}
+	rateLimiter := newRateLimitTransport(client.Transport)
+	tokenRefresher := &tokenRefreshTransport{next: rateLimiter}
+	client.Transport = tokenRefresher
+
+	names := make(map[string]bool)
+	bots := make([]*botSession, 0, len(tokens))
+	for _, bt := range tokens {
+		if names[bt.name] {
+			return nil, fmt.Errorf("duplicate bot name %q", bt.name)
+		}
+		names[bt.name] = true
+
+		token, err := bt.source(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error reading token for bot %q: %w", bt.name, err)
+		}
+		if token == "" {
+			return nil, fmt.Errorf("token for bot %q is empty", bt.name)
+		}
+
+		dcConn, err := discordgo.New(botAuthorization(token))
+		if err != nil {
+			return nil, err
+		}
+		dcConn.Client = client
+		dcConn.Dialer = c.opts.newGatewayDialer(tlsConfig)
+
+		dcConn.Identify.Intents = discordgo.IntentsAllWithoutPrivileged | discordgo.IntentGuildMembers
+		guildCreated := make(chan struct{}, 1)
+		dcConn.AddHandler(func(_ *discordgo.Session, _ *discordgo.GuildCreate) {
+			select {
+			case guildCreated <- struct{}{}:
+			default:
+			}
+		})
+		if err := dcConn.Open(); err != nil {
+			return nil, fmt.Errorf("error opening session for bot %q: %w", bt.name, err)
+		}
+		if err := waitForGuilds(ctx, dcConn, guildCreated); err != nil {
+			return nil, fmt.Errorf("error opening session for bot %q: %w", bt.name, err)
+		}
+		bots = append(bots, newBotSession(bt.name, dcConn, bt.source))
+	}
+
+	c.conn = newSessions(bots)
+	tokenRefresher.sessions = c.conn
+	c.opts.rateLimiter = rateLimiter
+	c.opts.skipped = newSkipReport()
+
+	return c, nil
+}
+
+// guildCreateTimeout bounds how long a new session waits for its guilds to become available.
+const guildCreateTimeout = 30 * time.Second
 
-	return &Connector{conn: dcConn}, nil
+// waitForGuilds waits for a Guild Create event for every guild of a session that has just opened. Ready only lists the
+// guilds as unavailable, without their names, roles or channels, which the filters and the choice of bot depend on.
+// Guilds that are still unavailable when the wait times out, such as those in an outage, are synced as they are.
+func waitForGuilds(ctx context.Context, s *discordgo.Session, guildCreated <-chan struct{}) error {
+	timeout := time.NewTimer(guildCreateTimeout)
+	defer timeout.Stop()
+
+	for {
+		unavailable := unavailableGuilds(s)
+		if len(unavailable) == 0 {
+			return nil
+		}
+
+		select {
+		case <-guildCreated:
+		case <-timeout.C:
+			ctxzap.Extract(ctx).Warn("guilds are still unavailable", zap.Strings("guild_ids", unavailable))
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// unavailableGuilds returns the IDs of the guilds in the state of the session that are still unavailable.
+func unavailableGuilds(s *discordgo.Session) []string {
+	s.State.RLock()
+	defer s.State.RUnlock()
+
+	var ids []string
+	for _, guild := range s.State.Guilds {
+		if guild.Unavailable {
+			ids = append(ids, guild.ID)
+		}
+	}
+	return ids
 }
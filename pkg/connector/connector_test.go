@@ -0,0 +1,404 @@
+package connector_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/ConductorOne/baton-discord/pkg/connector"
+	"github.com/ConductorOne/baton-discord/pkg/fakediscord"
+)
+
+const (
+	basicFixture = "../fakediscord/testdata/basic.json"
+
+	guildID      = "100000000000000001"
+	moderatorsID = "110000000000000001"
+	modChannelID = "300000000000000003"
+	restrictedID = "300000000000000005"
+	helperBotID  = "200000000000000004"
+)
+
+func testContext() context.Context {
+	return ctxzap.ToContext(context.Background(), zap.NewNop())
+}
+
+// newTestConnector starts a fake Discord server for the fixture and returns a connector syncing it.
+func newTestConnector(t *testing.T, fixturePath string, opts ...connector.Option) (*connector.Connector, *fakediscord.Server) {
+	t.Helper()
+
+	fixture, err := fakediscord.LoadFixture(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newFixtureConnector(t, fixture, opts...)
+}
+
+// newFixtureConnector is newTestConnector for a fixture that has already been loaded, and possibly changed.
+func newFixtureConnector(t *testing.T, fixture *fakediscord.Fixture, opts ...connector.Option) (*connector.Connector, *fakediscord.Server) {
+	t.Helper()
+
+	server := fakediscord.NewServer(fixture)
+	t.Cleanup(server.Close)
+
+	cb, err := connector.New(testContext(), "token", append([]connector.Option{connector.WithBaseURL(server.URL)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cb, server
+}
+
+func syncer(t *testing.T, cb *connector.Connector, resourceTypeID string) connectorbuilder.ResourceSyncer {
+	t.Helper()
+	for _, rs := range cb.ResourceSyncers(testContext()) {
+		if rs.ResourceType(testContext()).Id == resourceTypeID {
+			return rs
+		}
+	}
+	t.Fatalf("no syncer for resource type %s", resourceTypeID)
+	return nil
+}
+
+func listResource(t *testing.T, rs connectorbuilder.ResourceSyncer, id string) *v2.Resource {
+	t.Helper()
+	resources, _, _, err := rs.List(testContext(), nil, &pagination.Token{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, resource := range resources {
+		if resource.Id.Resource == id {
+			return resource
+		}
+	}
+	t.Fatalf("%s %s wasn't listed", rs.ResourceType(testContext()).Id, id)
+	return nil
+}
+
+// listGrants returns every page of the grants of a resource, with the annotations of the last page.
+func listGrants(t *testing.T, rs connectorbuilder.ResourceSyncer, resource *v2.Resource) ([]*v2.Grant, annotations.Annotations) {
+	t.Helper()
+	var grants []*v2.Grant
+	token := ""
+	for {
+		page, next, annos, err := rs.Grants(testContext(), resource, &pagination.Token{Token: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		grants = append(grants, page...)
+		if next == "" {
+			return grants, annos
+		}
+		token = next
+	}
+}
+
+func findGrant(grants []*v2.Grant, entitlementSlug string, principalType, principalID string) *v2.Grant {
+	for _, g := range grants {
+		if strings.HasSuffix(g.Entitlement.Id, ":"+entitlementSlug) && g.Principal.Id.ResourceType == principalType && g.Principal.Id.Resource == principalID {
+			return g
+		}
+	}
+	return nil
+}
+
+func TestEveryoneMembershipIsExpandedFromGuildAccess(t *testing.T) {
+	cb, _ := newTestConnector(t, basicFixture)
+	roles := syncer(t, cb, "role")
+	everyone := listResource(t, roles, guildID)
+
+	entitlements, _, _, err := roles.Entitlements(testContext(), everyone, &pagination.Token{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := entitlements[0].GrantableTo; len(got) != 2 || got[1].Id != "guild" {
+		t.Errorf("@everyone membership is grantable to %v, want user and guild", got)
+	}
+
+	grants, _ := listGrants(t, roles, everyone)
+	g := findGrant(grants, "Member of @everyone", "guild", guildID)
+	if g == nil {
+		t.Fatal("@everyone membership isn't granted to the guild")
+	}
+	expandable := &v2.GrantExpandable{}
+	annos := annotations.Annotations(g.Annotations)
+	if ok, err := annos.Pick(expandable); err != nil || !ok {
+		t.Fatalf("@everyone membership grant isn't expandable: %v", err)
+	}
+	if want := "guild:" + guildID + ":Access to Fixture Guild"; len(expandable.EntitlementIds) != 1 || expandable.EntitlementIds[0] != want {
+		t.Errorf("@everyone membership expands %v, want %s", expandable.EntitlementIds, want)
+	}
+}
+
+// Ready lists guilds without their names, which only arrive in Guild Create, so the name filter depends on the
+// connector waiting for it.
+func TestGuildNameFilter(t *testing.T) {
+	cb, _ := newTestConnector(t, basicFixture, connector.WithGuildFilter(&connector.GuildFilter{IncludeNames: []string{"Fixture*"}}))
+
+	guild := listResource(t, syncer(t, cb, "guild"), guildID)
+	if guild.DisplayName != "Fixture Guild" {
+		t.Errorf("the guild is named %q", guild.DisplayName)
+	}
+}
+
+func TestChannelOverwrites(t *testing.T) {
+	cb, _ := newTestConnector(t, basicFixture)
+	channels := syncer(t, cb, "channel")
+	moderators := listResource(t, channels, modChannelID)
+
+	grants, annos := listGrants(t, channels, moderators)
+	if findGrant(grants, "Denied ViewChannel for moderators", "role", guildID) == nil {
+		t.Error("the @everyone deny of View Channel isn't synced")
+	}
+	if findGrant(grants, "Denied ViewChannel for moderators", "role", moderatorsID) != nil {
+		t.Error("Moderators are denied View Channel, but their overwrite allows it")
+	}
+
+	// The last overwrite names a member who has left, which is skipped rather than failing the sync.
+	if !skipped(t, annos, "user", "200000000000000099") {
+		t.Error("the overwrite of a member who left isn't reported as skipped")
+	}
+}
+
+func TestForbiddenChannelIsSkipped(t *testing.T) {
+	cb, _ := newTestConnector(t, basicFixture)
+	channels := syncer(t, cb, "channel")
+
+	// The bot can't see the channel, so it is never listed, but it may have been by a sync with another token.
+	restricted := &v2.Resource{
+		Id:               &v2.ResourceId{ResourceType: "channel", Resource: restrictedID},
+		ParentResourceId: &v2.ResourceId{ResourceType: "guild", Resource: guildID},
+	}
+
+	_, _, annos, err := channels.Entitlements(testContext(), restricted, &pagination.Token{})
+	if err != nil {
+		t.Fatalf("a channel the bot can't access failed the sync: %v", err)
+	}
+	if !skipped(t, annos, "channel", restrictedID) {
+		t.Error("a channel the bot can't access isn't reported as skipped")
+	}
+}
+
+func TestBotModes(t *testing.T) {
+	tests := []struct {
+		mode          connector.BotMode
+		principalType string
+	}{
+		{connector.BotModeUser, "user"},
+		{connector.BotModeSeparate, "bot"},
+		{connector.BotModeExclude, ""},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			cb, _ := newTestConnector(t, basicFixture, connector.WithBotMode(tt.mode))
+			roles := syncer(t, cb, "role")
+			grants, _ := listGrants(t, roles, listResource(t, roles, "110000000000000003"))
+
+			var principalType string
+			for _, g := range grants {
+				if g.Principal.Id.Resource == helperBotID {
+					principalType = g.Principal.Id.ResourceType
+				}
+			}
+			if principalType != tt.principalType {
+				t.Errorf("the helper bot is granted its role as %q, want %q", principalType, tt.principalType)
+			}
+		})
+	}
+}
+
+// skipped reports whether the skipped_objects report lists the object.
+func skipped(t *testing.T, annos annotations.Annotations, resourceType, id string) bool {
+	t.Helper()
+	for _, a := range annos {
+		report := &structpb.Struct{}
+		if !a.MessageIs(report) {
+			continue
+		}
+		if err := a.UnmarshalTo(report); err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range report.Fields["skipped_objects"].GetListValue().GetValues() {
+			fields := entry.GetStructValue().GetFields()
+			if fields["resource_type"].GetStringValue() == resourceType && fields["id"].GetStringValue() == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forwardProxy is a proxy that forwards API requests and tunnels the gateway connection, counting both.
+type forwardProxy struct {
+	mtx      sync.Mutex
+	requests int
+	tunnels  int
+}
+
+func (p *forwardProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mtx.Lock()
+	if r.Method == http.MethodConnect {
+		p.tunnels++
+	} else {
+		p.requests++
+	}
+	p.mtx.Unlock()
+
+	if r.Method != http.MethodConnect {
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for name, values := range resp.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+
+	upstream, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "can't tunnel", http.StatusInternalServerError)
+		return
+	}
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	_, _ = client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	go func() {
+		_, _ = io.Copy(upstream, client)
+		upstream.Close()
+	}()
+	go func() {
+		_, _ = io.Copy(client, upstream)
+		client.Close()
+	}()
+}
+
+func TestHTTPProxy(t *testing.T) {
+	proxy := &forwardProxy{}
+	proxyServer := httptest.NewServer(proxy)
+	t.Cleanup(proxyServer.Close)
+	proxyURL, err := url.Parse(proxyServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cb, _ := newTestConnector(t, basicFixture, connector.WithHTTPProxy(proxyURL))
+	listResource(t, syncer(t, cb, "guild"), guildID)
+
+	proxy.mtx.Lock()
+	defer proxy.mtx.Unlock()
+	if proxy.requests == 0 {
+		t.Error("API requests didn't go through the proxy")
+	}
+	if proxy.tunnels == 0 {
+		t.Error("the gateway connection didn't go through the proxy")
+	}
+}
+
+func TestSeveralBotsShareGuilds(t *testing.T) {
+	cb, _ := newTestConnector(t, basicFixture, connector.WithBotToken("second", "second-token"))
+
+	// Every builder picks the bot for the guild at once.
+	var wg sync.WaitGroup
+	for _, rs := range cb.ResourceSyncers(testContext()) {
+		wg.Add(1)
+		go func(rs connectorbuilder.ResourceSyncer) {
+			defer wg.Done()
+			if _, _, _, err := rs.List(testContext(), nil, &pagination.Token{}); err != nil {
+				t.Error(err)
+			}
+		}(rs)
+	}
+	wg.Wait()
+
+	explanation, err := cb.Explain(testContext(), "200000000000000001", modChannelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Guild.ID != guildID {
+		t.Errorf("the channel was explained in guild %s, want %s", explanation.Guild.ID, guildID)
+	}
+}
+
+func TestTokenRotation(t *testing.T) {
+	fixture, err := fakediscord.LoadFixture(basicFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture.Token = "first-token"
+	server := fakediscord.NewServer(fixture)
+	t.Cleanup(server.Close)
+
+	var mtx sync.Mutex
+	token := "first-token"
+	cb, err := connector.New(testContext(), "", connector.WithBaseURL(server.URL), connector.WithTokenSource(func(context.Context) (string, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return token, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.RotateToken("second-token")
+	mtx.Lock()
+	token = "second-token"
+	mtx.Unlock()
+
+	// Requests rejected with the old token are retried with the new one, however many are made at once.
+	var wg sync.WaitGroup
+	for _, rs := range cb.ResourceSyncers(testContext()) {
+		wg.Add(1)
+		go func(rs connectorbuilder.ResourceSyncer) {
+			defer wg.Done()
+			if _, _, _, err := rs.List(testContext(), nil, &pagination.Token{}); err != nil {
+				t.Errorf("%s: %v", rs.ResourceType(testContext()).Id, err)
+			}
+		}(rs)
+	}
+	wg.Wait()
+}
+
+func TestScheduledEventGrantsEndWithShortPage(t *testing.T) {
+	cb, _ := newTestConnector(t, basicFixture)
+	events := syncer(t, cb, "scheduled_event")
+	event := listResource(t, events, "600000000000000001")
+
+	grants, next, _, err := events.Grants(testContext(), event, &pagination.Token{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grants) == 0 {
+		t.Fatal("nobody is interested in the event")
+	}
+	if next != "" {
+		t.Errorf("a page shorter than the page size has the next page token %q", next)
+	}
+}
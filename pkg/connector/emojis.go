@@ -0,0 +1,360 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	resource_sdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+var emojiResourceTypeID = "emoji"
+
+var emojiResourceType = &v2.ResourceType{
+	Id:          emojiResourceTypeID,
+	DisplayName: "Emoji",
+}
+
+var stickerResourceTypeID = "sticker"
+
+var stickerResourceType = &v2.ResourceType{
+	Id:          stickerResourceTypeID,
+	DisplayName: "Sticker",
+}
+
+// canUseEntitlement is the slug of the entitlement held by the roles allowed to use an emoji or sticker.
+const canUseEntitlement = "use"
+
+var stickerFormats = map[discordgo.StickerFormat]string{
+	discordgo.StickerFormatTypePNG:    "png",
+	discordgo.StickerFormatTypeAPNG:   "apng",
+	discordgo.StickerFormatTypeLottie: "lottie",
+	discordgo.StickerFormatTypeGIF:    "gif",
+}
+
+// withCreator adds the user who uploaded an emoji or sticker to its profile. Discord only returns it to bots with
+// the Manage Emojis and Stickers permission.
+func withCreator(profile map[string]interface{}, user *discordgo.User) map[string]interface{} {
+	if user != nil {
+		profile["creator_id"] = user.ID
+		profile["creator_username"] = user.Username
+	}
+	return profile
+}
+
+func newEmojiResource(emoji *discordgo.Emoji, guild *discordgo.Guild) (*v2.Resource, error) {
+	guildResource, err := resource_sdk.NewResourceID(guildResourceType, guild.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := withCreator(map[string]interface{}{
+		"roles":          stringsToValues(emoji.Roles),
+		"restricted":     len(emoji.Roles) > 0,
+		"managed":        emoji.Managed,
+		"animated":       emoji.Animated,
+		"available":      emoji.Available,
+		"require_colons": emoji.RequireColons,
+	}, emoji.User)
+
+	return resource_sdk.NewResource(
+		emoji.Name,
+		emojiResourceType,
+		emoji.ID,
+		resource_sdk.WithParentResourceID(guildResource),
+		withProfile(profile),
+		withExternalLink("channels", guild.ID),
+	)
+}
+
+func newStickerResource(sticker *discordgo.Sticker, guild *discordgo.Guild) (*v2.Resource, error) {
+	guildResource, err := resource_sdk.NewResourceID(guildResourceType, guild.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := withCreator(map[string]interface{}{
+		"tags":      sticker.Tags,
+		"format":    enumName(stickerFormats, sticker.FormatType),
+		"available": sticker.Available,
+	}, sticker.User)
+
+	return resource_sdk.NewResource(
+		sticker.Name,
+		stickerResourceType,
+		sticker.ID,
+		resource_sdk.WithParentResourceID(guildResource),
+		resource_sdk.WithDescription(sticker.Description),
+		withProfile(profile),
+		withExternalLink("channels", guild.ID),
+	)
+}
+
+func newCanUseEntitlement(resource *v2.Resource) *v2.Entitlement {
+	return entitlement.NewPermissionEntitlement(
+		resource,
+		canUseEntitlement,
+		entitlement.WithDisplayName(fmt.Sprintf("Can use %s", resource.DisplayName)),
+		entitlement.WithDescription(fmt.Sprintf("Allowed to use %s", resource.DisplayName)),
+		entitlement.WithGrantableTo(roleResourceType),
+	)
+}
+
+// newCanUseGrants grants the entitlement to the roles allowed to use an emoji or sticker, or to @everyone if it is
+// unrestricted. The grants are expanded to the members of the roles.
+func (o *syncOptions) newCanUseGrants(resource *v2.Resource, guild *discordgo.Guild, roles []*discordgo.Role, allowedRoleIDs []string) ([]*v2.Grant, error) {
+	var grants []*v2.Grant
+	for _, role := range roles {
+		if len(allowedRoleIDs) == 0 && !isEveryoneRole(role, guild.ID) {
+			continue
+		}
+		if len(allowedRoleIDs) > 0 && !contains(allowedRoleIDs, role.ID) {
+			continue
+		}
+		if !o.roleFilter.Allows(role) {
+			continue
+		}
+
+		rolePrincipal, err := newRoleResource(role, guild)
+		if err != nil {
+			return nil, err
+		}
+
+		grants = append(grants, grant.NewGrant(
+			resource,
+			canUseEntitlement,
+			rolePrincipal,
+			grant.WithAnnotation(&v2.GrantExpandable{
+				EntitlementIds: []string{newRoleAssignmentEntitlement(rolePrincipal, role.Name).Id},
+			}),
+		))
+	}
+	return grants, nil
+}
+
+// guildStickers returns the custom stickers of a guild. discordgo doesn't have a method for listing them.
+func guildStickers(s *discordgo.Session, guildID string) ([]*discordgo.Sticker, error) {
+	body, err := s.RequestWithBucketID("GET", discordgo.EndpointGuildStickers(guildID), nil, discordgo.EndpointGuildStickers(guildID))
+	if err != nil {
+		return nil, err
+	}
+
+	var stickers []*discordgo.Sticker
+	if err := json.Unmarshal(body, &stickers); err != nil {
+		return nil, err
+	}
+	return stickers, nil
+}
+
+// canUseCache keeps the guild and roles of every guild for the grants of its emojis or stickers, so that they are
+// fetched once per guild rather than once per emoji or sticker.
+type canUseCache struct {
+	mtx    sync.Mutex
+	guilds map[string]*discordgo.Guild
+	roles  map[string][]*discordgo.Role
+}
+
+func newCanUseCache() *canUseCache {
+	return &canUseCache{
+		guilds: make(map[string]*discordgo.Guild),
+		roles:  make(map[string][]*discordgo.Role),
+	}
+}
+
+// guild returns the guild and its roles, fetching them the first time.
+func (c *canUseCache) guild(s *discordgo.Session, guildID string) (*discordgo.Guild, []*discordgo.Role, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if guild, ok := c.guilds[guildID]; ok {
+		return guild, c.roles[guildID], nil
+	}
+
+	guild, err := s.Guild(guildID)
+	if err != nil {
+		return nil, nil, err
+	}
+	roles, err := s.GuildRoles(guildID)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.guilds[guildID] = guild
+	c.roles[guildID] = roles
+	return guild, roles, nil
+}
+
+type emojiBuilder struct {
+	conn *sessions
+	*syncOptions
+
+	cache *canUseCache
+
+	// emojiRoles are the roles allowed to use each emoji, kept from List for the grants. It is filled concurrently
+	// while listing guilds, so it is guarded by emojiMtx.
+	emojiMtx   sync.Mutex
+	emojiRoles map[string][]string
+}
+
+func (o *emojiBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return emojiResourceType
+}
+
+// List returns the custom emojis of every guild.
+func (o *emojiBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	resources, err := listGuildResources(ctx, o.syncOptions, o.conn, func(guild *discordgo.Guild) ([]*v2.Resource, error) {
+		emojis, err := o.conn.forGuild(guild.ID).GuildEmojis(guild.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		resources := []*v2.Resource{}
+		for _, emoji := range emojis {
+			resource, err := newEmojiResource(emoji, guild)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, resource)
+		}
+
+		o.emojiMtx.Lock()
+		defer o.emojiMtx.Unlock()
+		for _, emoji := range emojis {
+			o.emojiRoles[emoji.ID] = emoji.Roles
+		}
+		return resources, nil
+	})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return resources, "", o.annotations(), nil
+}
+
+func (o *emojiBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		newCanUseEntitlement(resource),
+	}, "", o.annotations(), nil
+}
+
+func (o *emojiBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	guildID := resource.ParentResourceId.Resource
+	guild, roles, err := o.cache.guild(o.conn.forGuild(guildID), guildID)
+	if err != nil {
+		if o.skip(ctx, guildResourceTypeID, guildID, err) {
+			return nil, "", o.annotations(), nil
+		}
+		return nil, "", nil, err
+	}
+
+	allowedRoleIDs, err := o.allowedRoleIDs(guildID, resource.Id.Resource)
+	if err != nil {
+		if o.skip(ctx, emojiResourceTypeID, resource.Id.Resource, err) {
+			return nil, "", o.annotations(), nil
+		}
+		return nil, "", nil, err
+	}
+
+	grants, err := o.newCanUseGrants(resource, guild, roles, allowedRoleIDs)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return grants, "", o.annotations(), nil
+}
+
+// allowedRoleIDs returns the roles allowed to use the emoji, as listed by List, or else as fetched from Discord.
+func (o *emojiBuilder) allowedRoleIDs(guildID string, emojiID string) ([]string, error) {
+	o.emojiMtx.Lock()
+	roleIDs, ok := o.emojiRoles[emojiID]
+	o.emojiMtx.Unlock()
+	if ok {
+		return roleIDs, nil
+	}
+
+	emoji, err := o.conn.forGuild(guildID).GuildEmoji(guildID, emojiID)
+	if err != nil {
+		return nil, err
+	}
+	return emoji.Roles, nil
+}
+
+func newEmojiBuilder(s *sessions, opts *syncOptions) *emojiBuilder {
+	return &emojiBuilder{
+		conn:        s,
+		syncOptions: opts,
+		cache:       newCanUseCache(),
+		emojiRoles:  make(map[string][]string),
+	}
+}
+
+type stickerBuilder struct {
+	conn *sessions
+	*syncOptions
+
+	cache *canUseCache
+}
+
+func (o *stickerBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return stickerResourceType
+}
+
+// List returns the custom stickers of every guild.
+func (o *stickerBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	resources, err := listGuildResources(ctx, o.syncOptions, o.conn, func(guild *discordgo.Guild) ([]*v2.Resource, error) {
+		stickers, err := guildStickers(o.conn.forGuild(guild.ID), guild.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		resources := []*v2.Resource{}
+		for _, sticker := range stickers {
+			resource, err := newStickerResource(sticker, guild)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, resource)
+		}
+		return resources, nil
+	})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return resources, "", o.annotations(), nil
+}
+
+func (o *stickerBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		newCanUseEntitlement(resource),
+	}, "", o.annotations(), nil
+}
+
+// Grants grants every sticker to @everyone, since Discord can't restrict stickers to roles.
+func (o *stickerBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	guildID := resource.ParentResourceId.Resource
+	guild, roles, err := o.cache.guild(o.conn.forGuild(guildID), guildID)
+	if err != nil {
+		if o.skip(ctx, guildResourceTypeID, guildID, err) {
+			return nil, "", o.annotations(), nil
+		}
+		return nil, "", nil, err
+	}
+
+	grants, err := o.newCanUseGrants(resource, guild, roles, nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return grants, "", o.annotations(), nil
+}
+
+func newStickerBuilder(s *sessions, opts *syncOptions) *stickerBuilder {
+	return &stickerBuilder{conn: s, syncOptions: opts, cache: newCanUseCache()}
+}
@@ -0,0 +1,79 @@
+package connector_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+
+	"github.com/ConductorOne/baton-discord/pkg/connector"
+)
+
+func TestEmojiGrantsFetchTheGuildOnce(t *testing.T) {
+	proxy := &forwardProxy{}
+	proxyServer := httptest.NewServer(proxy)
+	t.Cleanup(proxyServer.Close)
+	proxyURL, err := url.Parse(proxyServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb, _ := newTestConnector(t, basicFixture, connector.WithHTTPProxy(proxyURL))
+
+	emojis := syncer(t, cb, "emoji")
+	resources, _, _, err := emojis.List(testContext(), nil, &pagination.Token{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("listed %d emojis, want 2", len(resources))
+	}
+
+	proxy.mtx.Lock()
+	listed := proxy.requests
+	proxy.mtx.Unlock()
+
+	var principals []string
+	for _, resource := range resources {
+		grants, _ := listGrants(t, emojis, resource)
+		for _, g := range grants {
+			principals = append(principals, resource.Id.Resource+":"+g.Principal.Id.Resource)
+		}
+	}
+
+	proxy.mtx.Lock()
+	defer proxy.mtx.Unlock()
+	// The guild and its roles, once for both emojis.
+	if requests := proxy.requests - listed; requests != 2 {
+		t.Errorf("the grants of two emojis made %d requests, want 2", requests)
+	}
+	// partyparrot is unrestricted, and modhammer is restricted to Moderators and Admins.
+	want := []string{"700000000000000001:" + guildID, "700000000000000002:" + moderatorsID, "700000000000000002:110000000000000002"}
+	if !reflect.DeepEqual(principals, want) {
+		t.Errorf("the emojis are granted as %q, want %q", principals, want)
+	}
+}
+
+func TestEmojiAndStickerGrantsSkipUnknownGuilds(t *testing.T) {
+	cb, _ := newTestConnector(t, basicFixture)
+	const unknownGuildID = "100000000000000009"
+
+	for _, resourceType := range []string{"emoji", "sticker"} {
+		resource := &v2.Resource{
+			Id:               &v2.ResourceId{ResourceType: resourceType, Resource: "700000000000000009"},
+			ParentResourceId: &v2.ResourceId{ResourceType: "guild", Resource: unknownGuildID},
+		}
+		grants, _, annos, err := syncer(t, cb, resourceType).Grants(testContext(), resource, &pagination.Token{})
+		if err != nil {
+			t.Fatalf("the %s of an unknown guild failed the sync: %v", resourceType, err)
+		}
+		if len(grants) != 0 {
+			t.Errorf("the %s of an unknown guild has grants", resourceType)
+		}
+		if !skipped(t, annos, "guild", unknownGuildID) {
+			t.Errorf("the unknown guild of the %s isn't reported as skipped", resourceType)
+		}
+	}
+}
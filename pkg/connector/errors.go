@@ -0,0 +1,163 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// Errors returned by the Discord API are classified into these, so callers can tell an object that is gone or that
+// the bot can't see from a failure of the sync itself.
+var (
+	ErrMissingAccess  = errors.New("missing access")
+	ErrUnknownGuild   = errors.New("unknown guild")
+	ErrUnknownChannel = errors.New("unknown channel")
+	ErrUnknownMember  = errors.New("unknown member")
+	ErrUnknownRole    = errors.New("unknown role")
+	ErrUnknownEvent   = errors.New("unknown scheduled event")
+	ErrUnknownEmoji   = errors.New("unknown emoji")
+	ErrRateLimited    = errors.New("rate limited")
+)
+
+// classifyError wraps errors returned by discordgo with the matching Err* value. Other errors are returned unchanged.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var rateLimitErr *discordgo.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return fmt.Errorf("%w: %w", ErrRateLimited, err)
+	}
+
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) {
+		return err
+	}
+	if restErr.Response != nil && restErr.Response.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %w", ErrRateLimited, err)
+	}
+	if restErr.Message == nil {
+		return err
+	}
+
+	switch restErr.Message.Code {
+	case discordgo.ErrCodeMissingAccess, discordgo.ErrCodeMissingPermissions:
+		return fmt.Errorf("%w: %w", ErrMissingAccess, err)
+	case discordgo.ErrCodeUnknownGuild:
+		return fmt.Errorf("%w: %w", ErrUnknownGuild, err)
+	case discordgo.ErrCodeUnknownChannel:
+		return fmt.Errorf("%w: %w", ErrUnknownChannel, err)
+	case discordgo.ErrCodeUnknownMember:
+		return fmt.Errorf("%w: %w", ErrUnknownMember, err)
+	case discordgo.ErrCodeUnknownRole:
+		return fmt.Errorf("%w: %w", ErrUnknownRole, err)
+	case discordgo.ErrCodeUnknownGuildScheduledEvent:
+		return fmt.Errorf("%w: %w", ErrUnknownEvent, err)
+	case discordgo.ErrCodeUnknownEmoji:
+		return fmt.Errorf("%w: %w", ErrUnknownEmoji, err)
+	default:
+		return err
+	}
+}
+
+// isSkippable reports whether the error means a single object is gone or inaccessible, in which case the sync carries
+// on without it. Rate limits are never skippable, since they have already been retried by the transport.
+func isSkippable(err error) bool {
+	err = classifyError(err)
+	for _, skippable := range []error{ErrMissingAccess, ErrUnknownGuild, ErrUnknownChannel, ErrUnknownMember, ErrUnknownRole, ErrUnknownEvent, ErrUnknownEmoji} {
+		if errors.Is(err, skippable) {
+			return true
+		}
+	}
+	return false
+}
+
+// skippedObject is an object left out of the sync.
+type skippedObject struct {
+	resourceType string
+	id           string
+	reason       string
+}
+
+// skipReport collects the objects skipped during a sync.
+type skipReport struct {
+	mtx     sync.Mutex
+	objects map[skippedObject]struct{}
+}
+
+func newSkipReport() *skipReport {
+	return &skipReport{objects: make(map[skippedObject]struct{})}
+}
+
+// skip records the object and logs a warning if the error is skippable, and reports whether it was. Any other error
+// should abort the call.
+func (o *syncOptions) skip(ctx context.Context, resourceType string, id string, err error) bool {
+	if !isSkippable(err) {
+		return false
+	}
+
+	ctxzap.Extract(ctx).Warn(
+		"skipping inaccessible discord object",
+		zap.String("resource_type", resourceType),
+		zap.String("id", id),
+		zap.Error(err),
+	)
+
+	if o.skipped != nil {
+		o.skipped.mtx.Lock()
+		defer o.skipped.mtx.Unlock()
+		o.skipped.objects[skippedObject{resourceType: resourceType, id: id, reason: err.Error()}] = struct{}{}
+	}
+	return true
+}
+
+// annotations returns the annotations attached to every response: the rate limit state, and the objects skipped so
+// far in the sync.
+func (o *syncOptions) annotations() annotations.Annotations {
+	annos := o.rateLimiter.annotations()
+	if o.skipped == nil {
+		return annos
+	}
+
+	o.skipped.mtx.Lock()
+	defer o.skipped.mtx.Unlock()
+	if len(o.skipped.objects) == 0 {
+		return annos
+	}
+
+	objects := make([]skippedObject, 0, len(o.skipped.objects))
+	for object := range o.skipped.objects {
+		objects = append(objects, object)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].resourceType != objects[j].resourceType {
+			return objects[i].resourceType < objects[j].resourceType
+		}
+		return objects[i].id < objects[j].id
+	})
+
+	entries := make([]interface{}, 0, len(objects))
+	for _, object := range objects {
+		entries = append(entries, map[string]interface{}{
+			"resource_type": object.resourceType,
+			"id":            object.id,
+			"reason":        object.reason,
+		})
+	}
+	// The entries only hold strings, which always convert to a Struct.
+	report, err := newReport("skipped_objects", entries)
+	if err != nil {
+		return annos
+	}
+	annos.Append(report)
+	return annos
+}
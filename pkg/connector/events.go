@@ -0,0 +1,264 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	resource_sdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+var scheduledEventResourceTypeID = "scheduled_event"
+
+var scheduledEventResourceType = &v2.ResourceType{
+	Id:          scheduledEventResourceTypeID,
+	DisplayName: "Scheduled Event",
+}
+
+// scheduledEventAttendingEntitlement is the slug of the entitlement held by the users interested in an event. It
+// doesn't include the event name, so the entitlement ID survives the event being renamed.
+const scheduledEventAttendingEntitlement = "attending"
+
+// scheduledEventUsersPageSize is the most users Discord returns for an event at once.
+const scheduledEventUsersPageSize = 100
+
+var scheduledEventPrivacyLevels = map[discordgo.GuildScheduledEventPrivacyLevel]string{
+	discordgo.GuildScheduledEventPrivacyLevelGuildOnly: "guild_only",
+}
+
+var scheduledEventStatuses = map[discordgo.GuildScheduledEventStatus]string{
+	discordgo.GuildScheduledEventStatusScheduled: "scheduled",
+	discordgo.GuildScheduledEventStatusActive:    "active",
+	discordgo.GuildScheduledEventStatusCompleted: "completed",
+	discordgo.GuildScheduledEventStatusCanceled:  "canceled",
+}
+
+var scheduledEventEntityTypes = map[discordgo.GuildScheduledEventEntityType]string{
+	discordgo.GuildScheduledEventEntityTypeStageInstance: "stage_instance",
+	discordgo.GuildScheduledEventEntityTypeVoice:         "voice",
+	discordgo.GuildScheduledEventEntityTypeExternal:      "external",
+}
+
+type scheduledEventBuilder struct {
+	conn *sessions
+	*syncOptions
+}
+
+func (o *scheduledEventBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return scheduledEventResourceType
+}
+
+// scheduledEventProfile returns the profile of an event. Unknown enum values are reported as their number.
+func scheduledEventProfile(event *discordgo.GuildScheduledEvent) map[string]interface{} {
+	profile := map[string]interface{}{
+		"creator_id":           event.CreatorID,
+		"privacy_level":        enumName(scheduledEventPrivacyLevels, event.PrivacyLevel),
+		"status":               enumName(scheduledEventStatuses, event.Status),
+		"entity_type":          enumName(scheduledEventEntityTypes, event.EntityType),
+		"scheduled_start_time": event.ScheduledStartTime.Format(time.RFC3339),
+		"user_count":           event.UserCount,
+	}
+	if event.Creator != nil {
+		profile["creator_username"] = event.Creator.Username
+	}
+	if event.ScheduledEndTime != nil {
+		profile["scheduled_end_time"] = event.ScheduledEndTime.Format(time.RFC3339)
+	}
+	if event.ChannelID != "" {
+		profile["channel_id"] = event.ChannelID
+	}
+	if event.EntityMetadata.Location != "" {
+		profile["location"] = event.EntityMetadata.Location
+	}
+	return profile
+}
+
+func enumName[T comparable](names map[T]string, value T) string {
+	if name, ok := names[value]; ok {
+		return name
+	}
+	return fmt.Sprint(value)
+}
+
+// newScheduledEventResource returns the resource for an event. Its parent is the channel hosting it if that channel is
+// synced, and the guild otherwise, as for external events.
+func newScheduledEventResource(event *discordgo.GuildScheduledEvent, guild *discordgo.Guild, channel *discordgo.Channel) (*v2.Resource, error) {
+	parent, err := resource_sdk.NewResourceID(guildResourceType, guild.ID)
+	if err != nil {
+		return nil, err
+	}
+	if channel != nil {
+		parent, err = resource_sdk.NewResourceID(channelResourceType, channel.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resource_sdk.NewResource(
+		event.Name,
+		scheduledEventResourceType,
+		event.ID,
+		resource_sdk.WithParentResourceID(parent),
+		resource_sdk.WithDescription(event.Description),
+		withProfile(scheduledEventProfile(event)),
+		withExternalLink("events", guild.ID, event.ID),
+	)
+}
+
+// List returns the scheduled events of every guild. Events hosted in a channel excluded by the channel filter are
+// left out.
+func (o *scheduledEventBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	resources, err := listGuildResources(ctx, o.syncOptions, o.conn, o.listGuild)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return resources, "", o.annotations(), nil
+}
+
+func (o *scheduledEventBuilder) listGuild(guild *discordgo.Guild) ([]*v2.Resource, error) {
+	resources := []*v2.Resource{}
+
+	events, err := o.conn.forGuild(guild.ID).GuildScheduledEvents(guild.ID, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return resources, nil
+	}
+
+	channels, err := o.conn.forGuild(guild.ID).GuildChannels(guild.ID)
+	if err != nil {
+		return nil, err
+	}
+	channelsByID := make(map[string]*discordgo.Channel)
+	for _, channel := range channels {
+		channelsByID[channel.ID] = channel
+	}
+
+	for _, event := range events {
+		channel := channelsByID[event.ChannelID]
+		if channel != nil {
+			if !o.channelFilter.Allows(channel, channelsByID[channel.ParentID]) {
+				continue
+			}
+			if !isSyncedChannelType(channel) {
+				channel = nil
+			}
+		}
+
+		resource, err := newScheduledEventResource(event, guild, channel)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+
+	return resources, nil
+}
+
+func newScheduledEventAttendingEntitlement(resource *v2.Resource, opts ...entitlement.EntitlementOption) *v2.Entitlement {
+	return entitlement.NewAssignmentEntitlement(
+		resource,
+		scheduledEventAttendingEntitlement,
+		append([]entitlement.EntitlementOption{
+			entitlement.WithDisplayName(fmt.Sprintf("Interested in %s", resource.DisplayName)),
+			entitlement.WithDescription(fmt.Sprintf("Marked as interested in or attending %s", resource.DisplayName)),
+			entitlement.WithGrantableTo(userResourceType),
+		}, opts...)...,
+	)
+}
+
+func (o *scheduledEventBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		newScheduledEventAttendingEntitlement(resource, o.grantableToMembers()),
+	}, "", o.annotations(), nil
+}
+
+// scheduledEventGuildID returns the ID of the guild of an event resource, whose parent may be a channel.
+func (o *scheduledEventBuilder) scheduledEventGuildID(resource *v2.Resource) (string, error) {
+	if resource.ParentResourceId.ResourceType == guildResourceTypeID {
+		return resource.ParentResourceId.Resource, nil
+	}
+
+	channelID := resource.ParentResourceId.Resource
+	channel, err := o.conn.channel(channelID)
+	if err != nil {
+		return "", classifyError(err)
+	}
+	return channel.GuildID, nil
+}
+
+// Grants returns a page of the users interested in the event. The page token is the ID of the last user returned.
+func (o *scheduledEventBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	var grants []*v2.Grant
+
+	guildID, err := o.scheduledEventGuildID(resource)
+	if err != nil {
+		if o.skip(ctx, channelResourceTypeID, resource.ParentResourceId.Resource, err) {
+			return nil, "", o.annotations(), nil
+		}
+		return nil, "", nil, err
+	}
+
+	guild, err := o.conn.forGuild(guildID).Guild(guildID)
+	if err != nil {
+		if o.skip(ctx, guildResourceTypeID, guildID, err) {
+			return nil, "", o.annotations(), nil
+		}
+		return nil, "", nil, err
+	}
+
+	users, err := o.conn.forGuild(guildID).GuildScheduledEventUsers(
+		guildID,
+		resource.Id.Resource,
+		scheduledEventUsersPageSize,
+		true,
+		"",
+		pToken.Token,
+	)
+	if err != nil {
+		if o.skip(ctx, scheduledEventResourceTypeID, resource.Id.Resource, err) {
+			return nil, "", o.annotations(), nil
+		}
+		return nil, "", nil, err
+	}
+
+	for _, user := range users {
+		// Users who have left the guild are still listed, but aren't synced.
+		if user.Member == nil {
+			continue
+		}
+		member := user.Member
+		if member.User == nil {
+			member.User = user.User
+		}
+
+		userPrincipal, err := o.newMemberPrincipal(member, guild)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if userPrincipal == nil {
+			continue
+		}
+		grants = append(grants, grant.NewGrant(resource, scheduledEventAttendingEntitlement, userPrincipal))
+	}
+
+	// A short page is the last one.
+	nextPageToken := ""
+	if len(users) == scheduledEventUsersPageSize {
+		nextPageToken = users[len(users)-1].User.ID
+	}
+
+	return grants, nextPageToken, o.annotations(), nil
+}
+
+func newScheduledEventBuilder(s *sessions, opts *syncOptions) *scheduledEventBuilder {
+	return &scheduledEventBuilder{conn: s, syncOptions: opts}
+}
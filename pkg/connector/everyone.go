@@ -0,0 +1,49 @@
+package connector
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// The @everyone role shares its ID with the guild it belongs to and is implicitly held by every member.
+func isEveryoneRole(role *discordgo.Role, guildID string) bool {
+	return role.ID == guildID
+}
+
+// everyoneChannelPermissions applies the @everyone overwrite of a channel to the guild-wide @everyone permissions.
+func everyoneChannelPermissions(everyone *discordgo.Role, channel *discordgo.Channel) int64 {
+	perms := everyone.Permissions
+	if perms&discordgo.PermissionAdministrator == discordgo.PermissionAdministrator {
+		return perms
+	}
+
+	for _, overwrite := range channel.PermissionOverwrites {
+		if overwrite.Type != discordgo.PermissionOverwriteTypeRole || overwrite.ID != everyone.ID {
+			continue
+		}
+		perms &^= overwrite.Deny
+		perms |= overwrite.Allow
+	}
+
+	return perms
+}
+
+// isPublicToGuild reports whether every member of the guild can see the channel.
+func isPublicToGuild(everyone *discordgo.Role, channel *discordgo.Channel) bool {
+	perms := everyoneChannelPermissions(everyone, channel)
+	if perms&discordgo.PermissionAdministrator == discordgo.PermissionAdministrator {
+		return true
+	}
+	return perms&discordgo.PermissionViewChannel == discordgo.PermissionViewChannel
+}
+
+// permissionNames returns the names of the permissions set in the bitmask, in the order they are listed in perms.
+func permissionNames(bitmask int64, perms []int64) []string {
+	names := []string{}
+	for _, permission := range perms {
+		if bitmask&permission != permission {
+			continue
+		}
+		names = append(names, permNameFromVal[permission])
+	}
+	return names
+}
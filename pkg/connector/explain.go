@@ -0,0 +1,180 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// PermissionStep is a single step of the permission computation for a member in a channel.
+type PermissionStep struct {
+	Description string
+	Allow       int64
+	Deny        int64
+	Result      int64
+}
+
+// PermissionExplanation describes how the effective permissions of a member in a channel were computed.
+type PermissionExplanation struct {
+	Guild   *discordgo.Guild
+	Channel *discordgo.Channel
+	Member  *discordgo.Member
+	Steps   []PermissionStep
+	Result  int64
+}
+
+// Permissions returns the name of every known permission and whether the member ends up with it, sorted by name.
+func (e *PermissionExplanation) Permissions() []PermissionResult {
+	results := make([]PermissionResult, 0, len(permNameFromVal))
+	for permission, name := range permNameFromVal {
+		results = append(results, PermissionResult{
+			Name:    name,
+			Granted: e.Result&permission == permission,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// PermissionNames returns the names of the known permissions set in the bitmask.
+func PermissionNames(bitmask int64) []string {
+	return permissionNames(bitmask, rolePermissions)
+}
+
+// PermissionResult is the final state of a single permission.
+type PermissionResult struct {
+	Name    string
+	Granted bool
+}
+
+// Explain computes the effective permissions of a user in a channel, recording every step of the computation,
+// including the permissions Discord denies implicitly after applying the overwrites.
+func (d *Connector) Explain(ctx context.Context, userID string, channelID string) (*PermissionExplanation, error) {
+	channel, err := d.conn.channel(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newChannelBuilder(d.conn, &d.opts)
+
+	guild, err := d.conn.forGuild(channel.GuildID).Guild(channel.GuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := c.getMember(guild.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	everyone, err := c.getRole(guild.ID, guild.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &PermissionExplanation{
+		Guild:   guild,
+		Channel: channel,
+		Member:  member,
+	}
+	step := func(description string, allow, deny, result int64) {
+		explanation.Steps = append(explanation.Steps, PermissionStep{
+			Description: description,
+			Allow:       allow,
+			Deny:        deny,
+			Result:      result,
+		})
+		explanation.Result = result
+	}
+
+	if guild.OwnerID == member.User.ID {
+		step("Guild owner", discordgo.PermissionAll, 0, discordgo.PermissionAll)
+		return explanation, nil
+	}
+
+	perms := everyone.Permissions
+	step("Base permissions of @everyone", everyone.Permissions, 0, perms)
+
+	for _, roleID := range member.Roles {
+		role, err := c.getRole(guild.ID, roleID)
+		if err != nil {
+			return nil, err
+		}
+		perms |= role.Permissions
+		step(fmt.Sprintf("Base permissions of role %s", role.Name), role.Permissions, 0, perms)
+	}
+
+	if perms&discordgo.PermissionAdministrator == discordgo.PermissionAdministrator {
+		step("Administrator bypasses channel overwrites", discordgo.PermissionAll, 0, discordgo.PermissionAll)
+		return explanation, nil
+	}
+
+	// Overwrites are applied in the same order Discord applies them: @everyone, then all of the member's roles
+	// together, then the member.
+	for _, overwrite := range channel.PermissionOverwrites {
+		if overwrite.Type == discordgo.PermissionOverwriteTypeRole && overwrite.ID == everyone.ID {
+			perms &^= overwrite.Deny
+			perms |= overwrite.Allow
+			step("Overwrite for @everyone", overwrite.Allow, overwrite.Deny, perms)
+		}
+	}
+
+	var roleAllow, roleDeny int64
+	for _, overwrite := range channel.PermissionOverwrites {
+		if overwrite.Type != discordgo.PermissionOverwriteTypeRole || !contains(member.Roles, overwrite.ID) {
+			continue
+		}
+		role, err := c.getRole(guild.ID, overwrite.ID)
+		if err != nil {
+			return nil, err
+		}
+		roleAllow |= overwrite.Allow
+		roleDeny |= overwrite.Deny
+		step(fmt.Sprintf("Overwrite for role %s (applied with the other role overwrites)", role.Name), overwrite.Allow, overwrite.Deny, perms)
+	}
+	perms &^= roleDeny
+	perms |= roleAllow
+	step("Combined role overwrites", roleAllow, roleDeny, perms)
+
+	for _, overwrite := range channel.PermissionOverwrites {
+		if overwrite.Type == discordgo.PermissionOverwriteTypeMember && overwrite.ID == member.User.ID {
+			perms &^= overwrite.Deny
+			perms |= overwrite.Allow
+			step("Overwrite for member", overwrite.Allow, overwrite.Deny, perms)
+		}
+	}
+
+	// Discord then takes away the permissions that depend on others the member doesn't have.
+	implicit := func(description string, deny int64) {
+		if perms&deny == 0 {
+			return
+		}
+		perms &^= deny
+		step(description, 0, deny, perms)
+	}
+	if member.CommunicationDisabledUntil != nil && member.CommunicationDisabledUntil.After(time.Now()) {
+		implicit("Timed out members keep only View Channel and Read Message History", perms&^timedOutPermissions)
+	}
+	if perms&discordgo.PermissionViewChannel != discordgo.PermissionViewChannel {
+		implicit("Without View Channel, every channel permission is denied", perms)
+	}
+	if channel.Type != discordgo.ChannelTypeGuildVoice && perms&discordgo.PermissionSendMessages != discordgo.PermissionSendMessages {
+		implicit("Without Send Messages, the permissions that depend on sending are denied", sendMessagesDependentPermissions)
+	}
+
+	return explanation, nil
+}
+
+// timedOutPermissions are the only permissions a timed out member keeps.
+const timedOutPermissions = discordgo.PermissionViewChannel | discordgo.PermissionReadMessageHistory
+
+// sendMessagesDependentPermissions are the permissions of a text channel that are denied without Send Messages.
+const sendMessagesDependentPermissions = discordgo.PermissionSendTTSMessages |
+	discordgo.PermissionMentionEveryone |
+	discordgo.PermissionAttachFiles |
+	discordgo.PermissionEmbedLinks
@@ -0,0 +1,140 @@
+package connector_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/ConductorOne/baton-discord/pkg/connector"
+	"github.com/ConductorOne/baton-discord/pkg/fakediscord"
+)
+
+const (
+	generalChannelID = "300000000000000002"
+	daveID           = "200000000000000005"
+
+	everyonePermissions   = int64(1071698660929)
+	moderatorPermissions  = int64(1071698669121)
+	viewChannelPermission = discordgo.PermissionViewChannel
+)
+
+// explainFixture is the basic fixture with dave, a member without roles, who may be timed out.
+func explainFixture(t *testing.T, timedOut bool) *fakediscord.Fixture {
+	t.Helper()
+	fixture, err := fakediscord.LoadFixture(basicFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dave := &discordgo.Member{
+		User:  &discordgo.User{ID: daveID, Username: "dave"},
+		Roles: []string{},
+	}
+	if timedOut {
+		until := time.Now().Add(time.Hour)
+		dave.CommunicationDisabledUntil = &until
+	}
+	fixture.Guilds[0].Members = append(fixture.Guilds[0].Members, dave)
+	return fixture
+}
+
+func TestExplain(t *testing.T) {
+	everyoneWithModerators := everyonePermissions | moderatorPermissions
+	tests := []struct {
+		name      string
+		timedOut  bool
+		userID    string
+		channelID string
+		steps     []string
+		result    int64
+	}{
+		{
+			name:      "overwrites",
+			userID:    bobID,
+			channelID: modChannelID,
+			steps: []string{
+				"Base permissions of @everyone",
+				"Base permissions of role Moderators",
+				"Overwrite for @everyone",
+				"Overwrite for role Moderators (applied with the other role overwrites)",
+				"Combined role overwrites",
+				"Overwrite for member",
+			},
+			result: everyoneWithModerators | viewChannelPermission | discordgo.PermissionSendMessages,
+		},
+		{
+			name:      "denied View Channel",
+			userID:    daveID,
+			channelID: modChannelID,
+			steps: []string{
+				"Base permissions of @everyone",
+				"Overwrite for @everyone",
+				"Combined role overwrites",
+				"Without View Channel, every channel permission is denied",
+			},
+			result: 0,
+		},
+		{
+			name:      "timed out",
+			timedOut:  true,
+			userID:    daveID,
+			channelID: generalChannelID,
+			steps: []string{
+				"Base permissions of @everyone",
+				"Combined role overwrites",
+				"Timed out members keep only View Channel and Read Message History",
+			},
+			result: everyonePermissions & (viewChannelPermission | discordgo.PermissionReadMessageHistory),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb, _ := newFixtureConnector(t, explainFixture(t, tt.timedOut))
+			explanation, err := cb.Explain(testContext(), tt.userID, tt.channelID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var steps []string
+			for _, step := range explanation.Steps {
+				steps = append(steps, step.Description)
+			}
+			if !reflect.DeepEqual(steps, tt.steps) {
+				t.Errorf("steps are %q, want %q", steps, tt.steps)
+			}
+			if explanation.Result != tt.result {
+				t.Errorf("result is %v, want %v", connector.PermissionNames(explanation.Result), connector.PermissionNames(tt.result))
+			}
+		})
+	}
+}
+
+func TestExplainWithoutSendMessages(t *testing.T) {
+	fixture := explainFixture(t, false)
+	for _, channel := range fixture.Guilds[0].Channels {
+		if channel.ID == generalChannelID {
+			channel.PermissionOverwrites = []*discordgo.PermissionOverwrite{{
+				ID:   guildID,
+				Type: discordgo.PermissionOverwriteTypeRole,
+				Deny: discordgo.PermissionSendMessages,
+			}}
+		}
+	}
+	cb, _ := newFixtureConnector(t, fixture)
+
+	explanation, err := cb.Explain(testContext(), daveID, generalChannelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := explanation.Steps[len(explanation.Steps)-1]
+	if last.Description != "Without Send Messages, the permissions that depend on sending are denied" {
+		t.Fatalf("the last step is %q", last.Description)
+	}
+	if explanation.Result&(discordgo.PermissionEmbedLinks|discordgo.PermissionAttachFiles) != 0 {
+		t.Errorf("without Send Messages, the result still has %v", connector.PermissionNames(explanation.Result))
+	}
+	if explanation.Result&viewChannelPermission == 0 {
+		t.Error("View Channel was denied along with the permissions that depend on sending")
+	}
+}
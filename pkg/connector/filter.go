@@ -0,0 +1,207 @@
+package connector
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// GuildFilter limits the guilds that are synced. Names are matched with path.Match glob patterns.
+type GuildFilter struct {
+	IncludeIDs   []string
+	ExcludeIDs   []string
+	IncludeNames []string
+	ExcludeNames []string
+}
+
+// ValidatePatterns returns an error if any of the name patterns is malformed.
+func (f *GuildFilter) ValidatePatterns() error {
+	return validatePatterns(append(append([]string{}, f.IncludeNames...), f.ExcludeNames...))
+}
+
+// Allows reports whether the guild should be synced. A guild is synced if it matches an include rule (or there are
+// none), and doesn't match any exclude rule.
+func (f *GuildFilter) Allows(guild *discordgo.Guild) bool {
+	if f == nil {
+		return true
+	}
+
+	if contains(f.ExcludeIDs, guild.ID) || matchesAny(f.ExcludeNames, guild.Name) {
+		return false
+	}
+
+	if len(f.IncludeIDs) == 0 && len(f.IncludeNames) == 0 {
+		return true
+	}
+
+	return contains(f.IncludeIDs, guild.ID) || matchesAny(f.IncludeNames, guild.Name)
+}
+
+func (f *GuildFilter) profile() map[string]interface{} {
+	if f == nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"include_ids":   stringsToValues(f.IncludeIDs),
+		"exclude_ids":   stringsToValues(f.ExcludeIDs),
+		"include_names": stringsToValues(f.IncludeNames),
+		"exclude_names": stringsToValues(f.ExcludeNames),
+	}
+}
+
+// guilds returns the guilds that pass the filter, in the same order.
+func (f *GuildFilter) guilds(all []*discordgo.Guild) []*discordgo.Guild {
+	guilds := []*discordgo.Guild{}
+	for _, guild := range all {
+		if f.Allows(guild) {
+			guilds = append(guilds, guild)
+		}
+	}
+	return guilds
+}
+
+// checkGuildID returns an error if the guild with the given ID is excluded from the sync.
+func (f *GuildFilter) checkGuildID(s *sessions, guildID string) error {
+	if f == nil {
+		return nil
+	}
+
+	guild, err := s.stateGuild(guildID)
+	if err != nil {
+		return err
+	}
+
+	if !f.Allows(guild) {
+		return fmt.Errorf("guild %s is excluded by the guild filter", guildID)
+	}
+	return nil
+}
+
+// ChannelFilter limits the channels that are synced. Names and categories are matched with path.Match glob patterns,
+// categories against both the ID and the name of the channel's parent category.
+type ChannelFilter struct {
+	IncludeIDs        []string
+	ExcludeIDs        []string
+	IncludeNames      []string
+	ExcludeNames      []string
+	IncludeCategories []string
+	ExcludeCategories []string
+	ExcludeNSFW       bool
+}
+
+// ValidatePatterns returns an error if any of the name or category patterns is malformed.
+func (f *ChannelFilter) ValidatePatterns() error {
+	patterns := append(append([]string{}, f.IncludeNames...), f.ExcludeNames...)
+	patterns = append(append(patterns, f.IncludeCategories...), f.ExcludeCategories...)
+	return validatePatterns(patterns)
+}
+
+// Allows reports whether the channel should be synced. parent is the channel's category, and may be nil.
+func (f *ChannelFilter) Allows(channel *discordgo.Channel, parent *discordgo.Channel) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.ExcludeNSFW && channel.NSFW {
+		return false
+	}
+
+	if contains(f.ExcludeIDs, channel.ID) || matchesAny(f.ExcludeNames, channel.Name) || matchesCategory(f.ExcludeCategories, parent) {
+		return false
+	}
+
+	if len(f.IncludeIDs) == 0 && len(f.IncludeNames) == 0 && len(f.IncludeCategories) == 0 {
+		return true
+	}
+
+	return contains(f.IncludeIDs, channel.ID) || matchesAny(f.IncludeNames, channel.Name) || matchesCategory(f.IncludeCategories, parent)
+}
+
+func (f *ChannelFilter) profile() map[string]interface{} {
+	if f == nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"include_ids":        stringsToValues(f.IncludeIDs),
+		"exclude_ids":        stringsToValues(f.ExcludeIDs),
+		"include_names":      stringsToValues(f.IncludeNames),
+		"exclude_names":      stringsToValues(f.ExcludeNames),
+		"include_categories": stringsToValues(f.IncludeCategories),
+		"exclude_categories": stringsToValues(f.ExcludeCategories),
+		"exclude_nsfw":       f.ExcludeNSFW,
+	}
+}
+
+// RoleFilter limits the roles that are synced. Names are matched with path.Match glob patterns.
+type RoleFilter struct {
+	IncludeNames   []string
+	ExcludeNames   []string
+	ExcludeManaged bool
+}
+
+// ValidatePatterns returns an error if any of the name patterns is malformed.
+func (f *RoleFilter) ValidatePatterns() error {
+	return validatePatterns(append(append([]string{}, f.IncludeNames...), f.ExcludeNames...))
+}
+
+// Allows reports whether the role should be synced.
+func (f *RoleFilter) Allows(role *discordgo.Role) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.ExcludeManaged && role.Managed {
+		return false
+	}
+
+	if matchesAny(f.ExcludeNames, role.Name) {
+		return false
+	}
+
+	return len(f.IncludeNames) == 0 || matchesAny(f.IncludeNames, role.Name)
+}
+
+func (f *RoleFilter) profile() map[string]interface{} {
+	if f == nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"include_names":   stringsToValues(f.IncludeNames),
+		"exclude_names":   stringsToValues(f.ExcludeNames),
+		"exclude_managed": f.ExcludeManaged,
+	}
+}
+
+func matchesCategory(patterns []string, parent *discordgo.Channel) bool {
+	if parent == nil {
+		return false
+	}
+	return matchesAny(patterns, parent.ID) || matchesAny(patterns, parent.Name)
+}
+
+func stringsToValues(values []string) []interface{} {
+	out := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		out = append(out, v)
+	}
+	return out
+}
+
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package connector_test
+
+import (
+	"errors"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+
+	"github.com/ConductorOne/baton-discord/pkg/connector"
+)
+
+func TestGuildFilterAllows(t *testing.T) {
+	guild := &discordgo.Guild{ID: guildID, Name: "Fixture Guild"}
+	tests := []struct {
+		name   string
+		filter *connector.GuildFilter
+		want   bool
+	}{
+		{"no filter", nil, true},
+		{"empty filter", &connector.GuildFilter{}, true},
+		{"included by ID", &connector.GuildFilter{IncludeIDs: []string{guildID}}, true},
+		{"included by name", &connector.GuildFilter{IncludeNames: []string{"Fixture*"}}, true},
+		{"not included", &connector.GuildFilter{IncludeIDs: []string{"1"}, IncludeNames: []string{"Other*"}}, false},
+		{"excluded by ID", &connector.GuildFilter{ExcludeIDs: []string{guildID}}, false},
+		{"excluded by name", &connector.GuildFilter{ExcludeNames: []string{"* Guild"}}, false},
+		{"not excluded", &connector.GuildFilter{ExcludeIDs: []string{"1"}, ExcludeNames: []string{"Other*"}}, true},
+		{"exclude wins over include", &connector.GuildFilter{IncludeIDs: []string{guildID}, ExcludeNames: []string{"Fixture*"}}, false},
+		{"malformed include matches nothing", &connector.GuildFilter{IncludeNames: []string{"[Fixture"}}, false},
+		{"malformed exclude matches nothing", &connector.GuildFilter{ExcludeNames: []string{"[Fixture"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Allows(guild); got != tt.want {
+				t.Errorf("Allows is %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelFilterAllows(t *testing.T) {
+	category := &discordgo.Channel{ID: "300000000000000001", Name: "Staff", Type: discordgo.ChannelTypeGuildCategory}
+	channel := &discordgo.Channel{ID: modChannelID, Name: "mod-chat", ParentID: category.ID}
+	nsfw := &discordgo.Channel{ID: modChannelID, Name: "mod-chat", NSFW: true}
+	tests := []struct {
+		name    string
+		filter  *connector.ChannelFilter
+		channel *discordgo.Channel
+		parent  *discordgo.Channel
+		want    bool
+	}{
+		{"no filter", nil, channel, category, true},
+		{"empty filter", &connector.ChannelFilter{}, channel, category, true},
+		{"included by ID", &connector.ChannelFilter{IncludeIDs: []string{modChannelID}}, channel, category, true},
+		{"included by name", &connector.ChannelFilter{IncludeNames: []string{"mod-*"}}, channel, category, true},
+		{"included by category ID", &connector.ChannelFilter{IncludeCategories: []string{category.ID}}, channel, category, true},
+		{"included by category name", &connector.ChannelFilter{IncludeCategories: []string{"Sta*"}}, channel, category, true},
+		{"not included", &connector.ChannelFilter{IncludeNames: []string{"general"}, IncludeCategories: []string{"Public"}}, channel, category, false},
+		{"included by category without one", &connector.ChannelFilter{IncludeCategories: []string{"*"}}, channel, nil, false},
+		{"excluded by ID", &connector.ChannelFilter{ExcludeIDs: []string{modChannelID}}, channel, category, false},
+		{"excluded by name", &connector.ChannelFilter{ExcludeNames: []string{"*-chat"}}, channel, category, false},
+		{"excluded by category ID", &connector.ChannelFilter{ExcludeCategories: []string{category.ID}}, channel, category, false},
+		{"excluded by category name", &connector.ChannelFilter{ExcludeCategories: []string{"Staff"}}, channel, category, false},
+		{"excluded by category without one", &connector.ChannelFilter{ExcludeCategories: []string{"*"}}, channel, nil, true},
+		{"exclude wins over include", &connector.ChannelFilter{IncludeIDs: []string{modChannelID}, ExcludeCategories: []string{"Staff"}}, channel, category, false},
+		{"NSFW excluded", &connector.ChannelFilter{ExcludeNSFW: true}, nsfw, nil, false},
+		{"NSFW exclusion wins over include", &connector.ChannelFilter{IncludeIDs: []string{modChannelID}, ExcludeNSFW: true}, nsfw, nil, false},
+		{"NSFW exclusion keeps other channels", &connector.ChannelFilter{ExcludeNSFW: true}, channel, category, true},
+		{"malformed include matches nothing", &connector.ChannelFilter{IncludeNames: []string{"[mod"}, IncludeCategories: []string{"[Staff"}}, channel, category, false},
+		{"malformed exclude matches nothing", &connector.ChannelFilter{ExcludeNames: []string{"[mod"}, ExcludeCategories: []string{"[Staff"}}, channel, category, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Allows(tt.channel, tt.parent); got != tt.want {
+				t.Errorf("Allows is %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterValidatePatterns(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter interface{ ValidatePatterns() error }
+		valid  bool
+	}{
+		{"guild", &connector.GuildFilter{IncludeNames: []string{"Fixture*"}, ExcludeNames: []string{"Test ?"}}, true},
+		{"guild include", &connector.GuildFilter{IncludeNames: []string{"[Fixture"}}, false},
+		{"guild exclude", &connector.GuildFilter{ExcludeNames: []string{"[Fixture"}}, false},
+		{"channel", &connector.ChannelFilter{IncludeNames: []string{"mod-*"}, ExcludeCategories: []string{"[Ss]taff"}}, true},
+		{"channel name", &connector.ChannelFilter{ExcludeNames: []string{"[mod"}}, false},
+		{"channel category", &connector.ChannelFilter{IncludeCategories: []string{"[Staff"}}, false},
+		{"role", &connector.RoleFilter{IncludeNames: []string{"Mod*"}, ExcludeNames: []string{"@everyone"}}, true},
+		{"role name", &connector.RoleFilter{ExcludeNames: []string{"[Mod"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filter.ValidatePatterns()
+			if tt.valid && err != nil {
+				t.Errorf("ValidatePatterns returned %v", err)
+			}
+			if !tt.valid && !errors.Is(err, path.ErrBadPattern) {
+				t.Errorf("ValidatePatterns returned %v, want %v", err, path.ErrBadPattern)
+			}
+		})
+	}
+}
+
+func TestRoleFilterAllows(t *testing.T) {
+	everyone := &discordgo.Role{ID: guildID, Name: "@everyone"}
+	moderators := &discordgo.Role{ID: moderatorsID, Name: "Moderators"}
+	helper := &discordgo.Role{ID: "110000000000000003", Name: "Helper", Managed: true}
+	tests := []struct {
+		name   string
+		filter *connector.RoleFilter
+		role   *discordgo.Role
+		want   bool
+	}{
+		{"no filter", nil, moderators, true},
+		{"empty filter", &connector.RoleFilter{}, moderators, true},
+		{"included by name", &connector.RoleFilter{IncludeNames: []string{"Mod*"}}, moderators, true},
+		{"not included", &connector.RoleFilter{IncludeNames: []string{"Admins"}}, moderators, false},
+		{"excluded by name", &connector.RoleFilter{ExcludeNames: []string{"*s"}}, moderators, false},
+		{"exclude wins over include", &connector.RoleFilter{IncludeNames: []string{"Moderators"}, ExcludeNames: []string{"Mod*"}}, moderators, false},
+		{"malformed include matches nothing", &connector.RoleFilter{IncludeNames: []string{"[Mod"}}, moderators, false},
+		{"malformed exclude matches nothing", &connector.RoleFilter{ExcludeNames: []string{"[Mod"}}, moderators, true},
+		{"@everyone included by name", &connector.RoleFilter{IncludeNames: []string{"@everyone"}}, everyone, true},
+		{"@everyone not included", &connector.RoleFilter{IncludeNames: []string{"Mod*"}}, everyone, false},
+		{"@everyone excluded by name", &connector.RoleFilter{ExcludeNames: []string{"@*"}}, everyone, false},
+		{"managed role included by name", &connector.RoleFilter{IncludeNames: []string{"Helper"}}, helper, true},
+		{"managed role not included", &connector.RoleFilter{IncludeNames: []string{"Mod*"}}, helper, false},
+		{"managed role excluded by name", &connector.RoleFilter{ExcludeNames: []string{"Help*"}}, helper, false},
+		{"managed role excluded", &connector.RoleFilter{ExcludeManaged: true}, helper, false},
+		{"managed exclusion wins over include", &connector.RoleFilter{IncludeNames: []string{"Helper"}, ExcludeManaged: true}, helper, false},
+		{"managed exclusion keeps other roles", &connector.RoleFilter{ExcludeManaged: true}, moderators, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Allows(tt.role); got != tt.want {
+				t.Errorf("Allows is %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleFilterExcludesEveryoneAndManagedRoles(t *testing.T) {
+	cb, _ := newTestConnector(t, basicFixture, connector.WithRoleFilter(&connector.RoleFilter{
+		ExcludeNames:   []string{"@everyone"},
+		ExcludeManaged: true,
+	}))
+
+	resources, _, _, err := syncer(t, cb, "role").List(testContext(), nil, &pagination.Token{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, resource := range resources {
+		names = append(names, resource.DisplayName)
+	}
+	if want := []string{"Moderators", "Admins"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("synced the roles %q, want %q", names, want)
+	}
+}
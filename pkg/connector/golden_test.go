@@ -0,0 +1,83 @@
+package connector_test
+
+import (
+	"flag"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/ConductorOne/baton-discord/pkg/connector"
+	"github.com/ConductorOne/baton-discord/pkg/golden"
+)
+
+var update = flag.Bool("update", false, "Overwrite the golden files instead of comparing with them.")
+
+// TestGolden syncs the fixtures through the connector in every bot mode and compares everything synced with the
+// golden files, so that changes to resource, entitlement and grant IDs can't go unnoticed. Run it with -update to
+// accept the changes.
+func TestGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		golden  string
+		botMode connector.BotMode
+	}{
+		{"basic", basicFixture, "../fakediscord/testdata/basic.golden.json", connector.BotModeUser},
+		{"basic bots excluded", basicFixture, "../fakediscord/testdata/basic.exclude.golden.json", connector.BotModeExclude},
+		{"basic bots separate", basicFixture, "../fakediscord/testdata/basic.separate.golden.json", connector.BotModeSeparate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb, _ := newTestConnector(t, tt.fixture, connector.WithBotMode(tt.botMode))
+			c, err := connectorbuilder.NewConnector(testContext(), cb)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			snapshot, err := golden.Sync(testContext(), c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := golden.Check(snapshot, tt.golden, *update); err != nil {
+				t.Error(err)
+			}
+			checkGrantable(t, snapshot)
+		})
+	}
+}
+
+// checkGrantable fails if any grant is of an entitlement that isn't grantable to the type of its principal.
+func checkGrantable(t *testing.T, snapshot *golden.Snapshot) {
+	t.Helper()
+	grantableTo := make(map[string][]string)
+	for _, data := range snapshot.Entitlements {
+		en := &v2.Entitlement{}
+		if err := protojson.Unmarshal(data, en); err != nil {
+			t.Fatal(err)
+		}
+		for _, resourceType := range en.GrantableTo {
+			grantableTo[en.Id] = append(grantableTo[en.Id], resourceType.Id)
+		}
+	}
+	for _, data := range snapshot.Grants {
+		g := &v2.Grant{}
+		if err := protojson.Unmarshal(data, g); err != nil {
+			t.Fatal(err)
+		}
+		types, ok := grantableTo[g.Entitlement.Id]
+		if ok && !slicesContain(types, g.Principal.Id.ResourceType) {
+			t.Errorf("%s is granted to a %s, but is only grantable to %v", g.Entitlement.Id, g.Principal.Id.ResourceType, types)
+		}
+	}
+}
+
+func slicesContain(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
 	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	resource_sdk "github.com/conductorone/baton-sdk/pkg/types/resource"
 )
 
 var guildResourceTypeID = "guild"
@@ -17,10 +18,12 @@ var guildResourceTypeID = "guild"
 var guildResourceType = &v2.ResourceType{
 	Id:          guildResourceTypeID,
 	DisplayName: "Guild",
+	Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_GROUP},
 }
 
 type guildBuilder struct {
-	conn *discordgo.Session
+	conn *sessions
+	*syncOptions
 }
 
 func (o *guildBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
@@ -29,59 +32,196 @@ func (o *guildBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 
 // List returns all the guilds from the database as resource objects.
 func (o *guildBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	resources := []*v2.Resource{}
-	for _, guild := range o.conn.State.Guilds {
-		resources = append(resources, &v2.Resource{
-			Id: &v2.ResourceId{
-				ResourceType: guildResourceTypeID,
-				Resource:     guild.ID,
-			},
-			DisplayName: guild.Name,
-		})
+	resources, err := listGuildResources(ctx, o.syncOptions, o.conn, func(guild *discordgo.Guild) ([]*v2.Resource, error) {
+		roles, err := o.conn.forGuild(guild.ID).GuildRoles(guild.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		guildResource, err := newGuildResource(guild, roles)
+		if err != nil {
+			return nil, err
+		}
+		return []*v2.Resource{guildResource}, nil
+	})
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return resources, "", o.annotations(), nil
+}
+
+func newGuildResource(guild *discordgo.Guild, roles []*discordgo.Role) (*v2.Resource, error) {
+	// Every member holds the @everyone role, so its permissions are what any member can do by default.
+	defaultPermissions := []interface{}{}
+	for _, role := range roles {
+		if !isEveryoneRole(role, guild.ID) {
+			continue
+		}
+		for _, name := range permissionNames(role.Permissions, rolePermissions) {
+			defaultPermissions = append(defaultPermissions, name)
+		}
+	}
+
+	// The posture and default access of a guild are its group profile, since a guild is the group of its members.
+	profile := guildPosture(guild)
+	profile["default_member_permissions"] = defaultPermissions
+	traitOptions := []resource_sdk.GroupTraitOption{
+		resource_sdk.WithGroupProfile(profile),
 	}
-	return resources, "", nil, nil
+	if icon := newAssetRef(assetKindGuildIcon, guild.Icon, guild.ID); icon != nil {
+		traitOptions = append(traitOptions, resource_sdk.WithGroupIcon(icon))
+	}
+
+	return resource_sdk.NewGroupResource(
+		guild.Name,
+		guildResourceType,
+		guild.ID,
+		traitOptions,
+		withExternalLink("channels", guild.ID),
+	)
 }
 
-func newGuildAssignmentEntitlement(resource *v2.Resource, name, description string) *v2.Entitlement {
+func guildAccessEntitlementName(name string) string {
+	return fmt.Sprintf("Access to %s", name)
+}
+
+func newGuildAssignmentEntitlement(resource *v2.Resource, name, description string, opts ...entitlement.EntitlementOption) *v2.Entitlement {
 	return entitlement.NewAssignmentEntitlement(
 		resource,
-		fmt.Sprintf("Access to %s", name),
-		entitlement.WithGrantableTo(userResourceType),
-		entitlement.WithDescription(description),
+		guildAccessEntitlementName(name),
+		append([]entitlement.EntitlementOption{
+			entitlement.WithGrantableTo(userResourceType),
+			entitlement.WithDescription(description),
+		}, opts...)...,
+	)
+}
+
+func newGuildOwnerEntitlement(resource *v2.Resource, name string, opts ...entitlement.EntitlementOption) *v2.Entitlement {
+	return entitlement.NewPermissionEntitlement(
+		resource,
+		fmt.Sprintf("Owner of %s", name),
+		append([]entitlement.EntitlementOption{
+			entitlement.WithGrantableTo(userResourceType),
+			entitlement.WithDescription(fmt.Sprintf("Owns %s and bypasses every permission check", name)),
+		}, opts...)...,
 	)
 }
 
-// Entitlements always returns an empty slice for guilds.
-func (o *guildBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
-	guild, err := o.conn.Guild(resource.Id.Resource)
+func newGuildAdministratorEntitlement(resource *v2.Resource, name string, opts ...entitlement.EntitlementOption) *v2.Entitlement {
+	return entitlement.NewPermissionEntitlement(
+		resource,
+		fmt.Sprintf("Administrator of %s", name),
+		append([]entitlement.EntitlementOption{
+			entitlement.WithGrantableTo(userResourceType, roleResourceType),
+			entitlement.WithDescription(fmt.Sprintf("Holds the Administrator permission in %s", name)),
+			withPermissionMetadata(discordgo.PermissionAdministrator),
+		}, opts...)...,
+	)
+}
+
+func (o *guildBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	guild, err := o.conn.forGuild(resource.Id.Resource).Guild(resource.Id.Resource)
 	if err != nil {
+		if o.skip(ctx, guildResourceTypeID, resource.Id.Resource, err) {
+			return nil, "", o.annotations(), nil
+		}
 		return nil, "", nil, err
 	}
 
 	return []*v2.Entitlement{
-		newGuildAssignmentEntitlement(resource, guild.Name, guild.Description),
-	}, "", nil, nil
+		newGuildAssignmentEntitlement(resource, guild.Name, guild.Description, o.grantableToMembers()),
+		newGuildOwnerEntitlement(resource, guild.Name, o.grantableToMembers()),
+		newGuildAdministratorEntitlement(resource, guild.Name, o.grantableToMembers(roleResourceType)),
+	}, "", o.annotations(), nil
+}
+
+// privilegedGrants returns the owner and administrator grants of a guild. Administrator roles are granted the
+// entitlement directly and expanded to their members.
+func (o *guildBuilder) privilegedGrants(ctx context.Context, resource *v2.Resource, guild *discordgo.Guild) ([]*v2.Grant, error) {
+	var grants []*v2.Grant
+
+	owner, err := o.conn.forGuild(guild.ID).GuildMember(guild.ID, guild.OwnerID)
+	switch {
+	case err == nil:
+		ownerPrincipal, err := o.newMemberPrincipal(owner, guild)
+		if err != nil {
+			return nil, err
+		}
+		if ownerPrincipal != nil {
+			grants = append(
+				grants,
+				grant.NewGrant(resource, newGuildOwnerEntitlement(resource, guild.Name).DisplayName, ownerPrincipal),
+				grant.NewGrant(resource, newGuildAdministratorEntitlement(resource, guild.Name).DisplayName, ownerPrincipal),
+			)
+		}
+	case !o.skip(ctx, userResourceTypeID, guild.OwnerID, err):
+		return nil, err
+	}
+
+	roles, err := o.conn.forGuild(guild.ID).GuildRoles(guild.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range roles {
+		if role.Permissions&discordgo.PermissionAdministrator != discordgo.PermissionAdministrator || !o.roleFilter.Allows(role) {
+			continue
+		}
+
+		rolePrincipal, err := newRoleResource(role, guild)
+		if err != nil {
+			return nil, err
+		}
+
+		grants = append(grants, grant.NewGrant(
+			resource,
+			newGuildAdministratorEntitlement(resource, guild.Name).DisplayName,
+			rolePrincipal,
+			grant.WithAnnotation(&v2.GrantExpandable{
+				EntitlementIds: []string{newRoleAssignmentEntitlement(rolePrincipal, role.Name).Id},
+			}),
+		))
+	}
+
+	return grants, nil
 }
 
 func (o *guildBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
 	var grants []*v2.Grant
 
-	guild, err := o.conn.Guild(resource.Id.Resource)
+	guild, err := o.conn.forGuild(resource.Id.Resource).Guild(resource.Id.Resource)
 	if err != nil {
+		if o.skip(ctx, guildResourceTypeID, resource.Id.Resource, err) {
+			return nil, "", o.annotations(), nil
+		}
 		return nil, "", nil, err
 	}
 
-	guildMembers, err := o.conn.GuildMembers(resource.Id.Resource, pToken.Token, 1000)
+	if pToken.Token == "" {
+		privilegedGrants, err := o.privilegedGrants(ctx, resource, guild)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		grants = append(grants, privilegedGrants...)
+	}
+
+	guildMembers, err := o.conn.forGuild(resource.Id.Resource).GuildMembers(resource.Id.Resource, pToken.Token, 1000)
 	if err != nil {
+		if o.skip(ctx, guildResourceTypeID, resource.Id.Resource, err) {
+			return grants, "", o.annotations(), nil
+		}
 		return nil, "", nil, err
 	}
 
 	for _, member := range guildMembers {
-		userPrincipal, err := newMemberResource(member, guild)
+		userPrincipal, err := o.newMemberPrincipal(member, guild)
 		if err != nil {
 			return nil, "", nil, err
 		}
-		grants = append(grants, grant.NewGrant(resource, fmt.Sprintf("Access to %s", guild.Name), userPrincipal))
+		if userPrincipal == nil {
+			continue
+		}
+		grants = append(grants, grant.NewGrant(resource, guildAccessEntitlementName(guild.Name), userPrincipal))
 	}
 
 	nextPageToken := ""
@@ -89,9 +229,9 @@ func (o *guildBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken
 		nextPageToken = guildMembers[len(guildMembers)-1].User.ID
 	}
 
-	return grants, nextPageToken, nil, nil
+	return grants, nextPageToken, o.annotations(), nil
 }
 
-func newGuildBuilder(s *discordgo.Session) *guildBuilder {
-	return &guildBuilder{conn: s}
+func newGuildBuilder(s *sessions, opts *syncOptions) *guildBuilder {
+	return &guildBuilder{conn: s, syncOptions: opts}
 }
@@ -0,0 +1,110 @@
+package connector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/gorilla/websocket"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+)
+
+// defaultRequestTimeout matches the timeout of the client discordgo creates by default.
+const defaultRequestTimeout = 20 * time.Second
+
+// userAgent identifies the connector in API requests.
+const userAgent = "baton-discord"
+
+// gatewayHandshakeTimeout matches the websocket dialer discordgo uses by default.
+const gatewayHandshakeTimeout = 45 * time.Second
+
+// tlsConfig returns the TLS configuration for connections to Discord, trusting the configured CA certificates in
+// addition to the system ones.
+func (o *syncOptions) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(o.caCertificates) == 0 {
+		return config, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, pem := range o.caCertificates {
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA certificate PEM")
+		}
+	}
+	config.RootCAs = pool
+	return config, nil
+}
+
+// proxy returns the proxy function for connections to Discord: the configured proxy, or else the one set in the
+// environment as HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+func (o *syncOptions) proxy() func(*http.Request) (*url.URL, error) {
+	if o.httpProxy != nil {
+		return http.ProxyURL(o.httpProxy)
+	}
+	return http.ProxyFromEnvironment
+}
+
+// newHTTPClient returns the client used for API requests. The SDK's client always takes its proxy from the
+// environment, so a configured proxy gets a transport of its own, set up the same way.
+func (o *syncOptions) newHTTPClient(ctx context.Context, tlsConfig *tls.Config) (*http.Client, error) {
+	var client *http.Client
+	if o.httpProxy == nil {
+		var err error
+		client, err = uhttp.NewClient(
+			ctx,
+			uhttp.WithTLSClientConfig(tlsConfig),
+			uhttp.WithLogger(true, ctxzap.Extract(ctx)),
+			uhttp.WithUserAgent(userAgent),
+		)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		base, ok := http.DefaultTransport.(*http.Transport)
+		if !ok {
+			return nil, errors.New("the default HTTP transport has been replaced, so a proxy can't be set on it")
+		}
+		transport := base.Clone()
+		transport.Proxy = o.proxy()
+		transport.TLSClientConfig = tlsConfig
+		client = &http.Client{Transport: &userAgentTransport{next: transport}}
+	}
+
+	client.Timeout = defaultRequestTimeout
+	if o.requestTimeout > 0 {
+		client.Timeout = o.requestTimeout
+	}
+	return client, nil
+}
+
+// userAgentTransport identifies requests as coming from the connector, like the SDK's client does.
+type userAgentTransport struct {
+	next http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", userAgent)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// newGatewayDialer returns the dialer used to connect to the gateway, with the same TLS and proxy settings as the
+// HTTP client.
+func (o *syncOptions) newGatewayDialer(tlsConfig *tls.Config) *websocket.Dialer {
+	return &websocket.Dialer{
+		Proxy:            o.proxy(),
+		HandshakeTimeout: gatewayHandshakeTimeout,
+		TLSClientConfig:  tlsConfig,
+	}
+}
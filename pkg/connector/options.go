@@ -0,0 +1,136 @@
+package connector
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// syncOptions holds the optional behavior shared by the connector and its resource syncers.
+type syncOptions struct {
+	guildFilter   *GuildFilter
+	channelFilter *ChannelFilter
+	roleFilter    *RoleFilter
+	botMode       BotMode
+
+	guildConcurrency int
+
+	// baseURL replaces https://discord.com/ as the address of the Discord API.
+	baseURL string
+
+	requestTimeout time.Duration
+	// httpProxy is the proxy API and gateway traffic goes through. Without it, the proxy is taken from the environment.
+	httpProxy *url.URL
+	// caCertificates are PEM encoded certificates trusted in addition to the system ones.
+	caCertificates [][]byte
+
+	// tokenSource provides the token of the default bot, if it wasn't passed to New.
+	tokenSource TokenSource
+	// botTokens are the tokens of the bots other than the default one, in the order they were configured.
+	botTokens []botToken
+
+	// transport wraps the HTTP transport of the session, below rate limiting, so it sees every attempt at a request.
+	transport func(http.RoundTripper) http.RoundTripper
+
+	// rateLimiter is the request layer of the session, set up by New rather than by an Option.
+	rateLimiter *rateLimitTransport
+	// skipped collects the objects left out of the sync because they are gone or inaccessible.
+	skipped *skipReport
+}
+
+type botToken struct {
+	name   string
+	source TokenSource
+}
+
+// Option configures optional behavior of the connector.
+type Option func(*syncOptions)
+
+// WithGuildFilter limits the sync to the guilds allowed by the filter.
+func WithGuildFilter(filter *GuildFilter) Option {
+	return func(o *syncOptions) {
+		o.guildFilter = filter
+	}
+}
+
+// WithChannelFilter limits the sync to the channels allowed by the filter.
+func WithChannelFilter(filter *ChannelFilter) Option {
+	return func(o *syncOptions) {
+		o.channelFilter = filter
+	}
+}
+
+// WithBotMode controls how bot accounts are synced.
+func WithBotMode(mode BotMode) Option {
+	return func(o *syncOptions) {
+		o.botMode = mode
+	}
+}
+
+// WithGuildConcurrency sets how many guilds are fetched at once.
+func WithGuildConcurrency(n int) Option {
+	return func(o *syncOptions) {
+		o.guildConcurrency = n
+	}
+}
+
+// WithBaseURL sends API requests to baseURL instead of https://discord.com/, for example to point the connector at a
+// fake Discord API.
+func WithBaseURL(baseURL string) Option {
+	return func(o *syncOptions) {
+		o.baseURL = baseURL
+	}
+}
+
+// WithBotToken adds a bot to the sync. Guilds visible to more than one bot are synced through the bot with the most
+// permissions in the guild.
+func WithBotToken(name, token string) Option {
+	return func(o *syncOptions) {
+		o.botTokens = append(o.botTokens, botToken{name: name, source: staticToken(token)})
+	}
+}
+
+// WithTokenSource reads the token of the default bot from the source, instead of taking the token passed to New. The
+// source is read again whenever Discord rejects the token.
+func WithTokenSource(source TokenSource) Option {
+	return func(o *syncOptions) {
+		o.tokenSource = source
+	}
+}
+
+// WithRequestTimeout limits how long a single API request may take.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *syncOptions) {
+		o.requestTimeout = timeout
+	}
+}
+
+// WithCACertificates trusts the PEM encoded CA certificates, in addition to the system ones, for connections to
+// Discord. This is needed behind proxies that intercept TLS.
+func WithCACertificates(pems ...[]byte) Option {
+	return func(o *syncOptions) {
+		o.caCertificates = append(o.caCertificates, pems...)
+	}
+}
+
+// WithHTTPProxy sends API requests and the gateway connection through the proxy, instead of the one set in the
+// environment, if any.
+func WithHTTPProxy(proxyURL *url.URL) Option {
+	return func(o *syncOptions) {
+		o.httpProxy = proxyURL
+	}
+}
+
+// WithTransport wraps the HTTP transport used for API requests, for example to record the responses.
+func WithTransport(wrap func(http.RoundTripper) http.RoundTripper) Option {
+	return func(o *syncOptions) {
+		o.transport = wrap
+	}
+}
+
+// WithRoleFilter limits the sync to the roles allowed by the filter.
+func WithRoleFilter(filter *RoleFilter) Option {
+	return func(o *syncOptions) {
+		o.roleFilter = filter
+	}
+}
@@ -0,0 +1,73 @@
+package connector
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+var verificationLevelNames = map[discordgo.VerificationLevel]string{
+	discordgo.VerificationLevelNone:     "none",
+	discordgo.VerificationLevelLow:      "low",
+	discordgo.VerificationLevelMedium:   "medium",
+	discordgo.VerificationLevelHigh:     "high",
+	discordgo.VerificationLevelVeryHigh: "very_high",
+}
+
+var explicitContentFilterNames = map[discordgo.ExplicitContentFilterLevel]string{
+	discordgo.ExplicitContentFilterDisabled:            "disabled",
+	discordgo.ExplicitContentFilterMembersWithoutRoles: "members_without_roles",
+	discordgo.ExplicitContentFilterAllMembers:          "all_members",
+}
+
+var nsfwLevelNames = map[discordgo.GuildNSFWLevel]string{
+	discordgo.GuildNSFWLevelDefault:       "default",
+	discordgo.GuildNSFWLevelExplicit:      "explicit",
+	discordgo.GuildNSFWLevelSafe:          "safe",
+	discordgo.GuildNSFWLevelAgeRestricted: "age_restricted",
+}
+
+var mfaLevelNames = map[discordgo.MfaLevel]string{
+	discordgo.MfaLevelNone:     "none",
+	discordgo.MfaLevelElevated: "elevated",
+}
+
+var messageNotificationNames = map[discordgo.MessageNotifications]string{
+	discordgo.MessageNotificationsAllMessages:  "all_messages",
+	discordgo.MessageNotificationsOnlyMentions: "only_mentions",
+}
+
+// Posture findings reported on guilds.
+const (
+	postureFindingMFANotRequired  = "mfa_not_required_for_moderators"
+	postureFindingLowVerification = "low_verification_level"
+)
+
+// guildPosture returns the security related settings of a guild, along with the findings of the posture check.
+func guildPosture(guild *discordgo.Guild) map[string]interface{} {
+	features := []interface{}{}
+	for _, feature := range guild.Features {
+		features = append(features, string(feature))
+	}
+
+	return map[string]interface{}{
+		"mfa_level":                     mfaLevelNames[guild.MfaLevel],
+		"verification_level":            verificationLevelNames[guild.VerificationLevel],
+		"explicit_content_filter":       explicitContentFilterNames[guild.ExplicitContentFilter],
+		"nsfw_level":                    nsfwLevelNames[guild.NSFWLevel],
+		"default_message_notifications": messageNotificationNames[guild.DefaultMessageNotifications],
+		"features":                      features,
+		"posture_findings":              stringsToValues(postureFindings(guild)),
+	}
+}
+
+// postureFindings flags guilds that don't require MFA for moderation actions, or that only require members to have a
+// verified email, if anything.
+func postureFindings(guild *discordgo.Guild) []string {
+	findings := []string{}
+	if guild.MfaLevel == discordgo.MfaLevelNone {
+		findings = append(findings, postureFindingMFANotRequired)
+	}
+	if guild.VerificationLevel <= discordgo.VerificationLevelLow {
+		findings = append(findings, postureFindingLowVerification)
+	}
+	return findings
+}
@@ -0,0 +1,195 @@
+package connector
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultMaxRetries = 5
+	defaultRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 60 * time.Second
+)
+
+// rateLimitTransport sits between the discord session and the network. It retries rate limited and transiently
+// failing requests with backoff, and remembers the rate limit state reported by Discord's bucket headers so that it
+// can be handed to the SDK.
+type rateLimitTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+	retryDelay time.Duration
+
+	// buckets is the last rate limit state of every bucket, keyed by the bucket Discord reports.
+	mtx     sync.Mutex
+	buckets map[string]*v2.RateLimitDescription
+}
+
+func newRateLimitTransport(next http.RoundTripper) *rateLimitTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &rateLimitTransport{
+		next:       next,
+		maxRetries: defaultMaxRetries,
+		retryDelay: defaultRetryDelay,
+		buckets:    make(map[string]*v2.RateLimitDescription),
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		t.observe(resp)
+
+		if !isRetryableStatus(resp.StatusCode) || attempt >= t.maxRetries {
+			return resp, nil
+		}
+
+		delay := t.backoff(resp, attempt)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff prefers the delay Discord asks for, and otherwise backs off exponentially.
+func (t *rateLimitTransport) backoff(resp *http.Response, attempt int) time.Duration {
+	for _, header := range []string{"Retry-After", "X-RateLimit-Reset-After"} {
+		if seconds, err := strconv.ParseFloat(resp.Header.Get(header), 64); err == nil && seconds > 0 {
+			return capRetryDelay(time.Duration(seconds * float64(time.Second)))
+		}
+	}
+
+	return capRetryDelay(time.Duration(float64(t.retryDelay) * math.Pow(2, float64(attempt))))
+}
+
+func capRetryDelay(delay time.Duration) time.Duration {
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// rateLimitBucket returns the bucket of the response: the one Discord names, the global limit, or else the route.
+func rateLimitBucket(resp *http.Response) string {
+	if resp.Header.Get("X-RateLimit-Global") == "true" {
+		return "global"
+	}
+	if bucket := resp.Header.Get("X-RateLimit-Bucket"); bucket != "" {
+		return bucket
+	}
+	if resp.Request != nil {
+		return resp.Request.Method + " " + resp.Request.URL.Path
+	}
+	return ""
+}
+
+// observe records the rate limit state of the bucket the response belongs to.
+func (t *rateLimitTransport) observe(resp *http.Response) {
+	limit, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Limit"), 10, 64)
+	if err != nil && resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+
+	desc := &v2.RateLimitDescription{
+		Status: v2.RateLimitDescription_STATUS_OK,
+		Limit:  limit,
+	}
+	if remaining, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Remaining"), 10, 64); err == nil {
+		desc.Remaining = remaining
+	}
+	if resetAfter, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Reset-After"), 64); err == nil {
+		desc.ResetAt = timestamppb.New(time.Now().Add(time.Duration(resetAfter * float64(time.Second))))
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		desc.Status = v2.RateLimitDescription_STATUS_OVERLIMIT
+		if desc.ResetAt == nil {
+			desc.ResetAt = timestamppb.New(time.Now().Add(t.backoff(resp, 0)))
+		}
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.buckets[rateLimitBucket(resp)] = desc
+}
+
+// annotations returns the rate limit state of the most constrained bucket that hasn't reset yet, if any: a bucket over
+// its limit, or else the one with the smallest share of its limit remaining. Responses are built from requests to many
+// buckets, so that is the state that decides how soon more requests can be made.
+func (t *rateLimitTransport) annotations() annotations.Annotations {
+	var annos annotations.Annotations
+	if t == nil {
+		return annos
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	now := time.Now()
+	var constrained *v2.RateLimitDescription
+	for bucket, desc := range t.buckets {
+		if desc.ResetAt != nil && desc.ResetAt.AsTime().Before(now) {
+			delete(t.buckets, bucket)
+			continue
+		}
+		if constrained == nil || moreConstrained(desc, constrained) {
+			constrained = desc
+		}
+	}
+	if constrained == nil {
+		return annos
+	}
+
+	annos.WithRateLimiting(proto.Clone(constrained).(*v2.RateLimitDescription))
+	return annos
+}
+
+// moreConstrained reports whether a leaves fewer requests to make than b.
+func moreConstrained(a, b *v2.RateLimitDescription) bool {
+	aOver := a.Status == v2.RateLimitDescription_STATUS_OVERLIMIT
+	bOver := b.Status == v2.RateLimitDescription_STATUS_OVERLIMIT
+	if aOver != bOver {
+		return aOver
+	}
+	if a.Limit <= 0 || b.Limit <= 0 {
+		return a.Remaining < b.Remaining
+	}
+	return float64(a.Remaining)/float64(a.Limit) < float64(b.Remaining)/float64(b.Limit)
+}
@@ -0,0 +1,249 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+
+	"github.com/ConductorOne/baton-discord/pkg/fakediscord"
+)
+
+// failingTransport answers the first requests with the responses in failures, and forwards the rest. It records the
+// body of every request it sees.
+type failingTransport struct {
+	next     http.RoundTripper
+	failures []*http.Response
+	bodies   []string
+}
+
+func (f *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	f.bodies = append(f.bodies, string(body))
+
+	if len(f.bodies) <= len(f.failures) {
+		resp := f.failures[len(f.bodies)-1]
+		resp.Request = req
+		return resp, nil
+	}
+
+	// The body has been consumed, as it is by a real failed attempt, so only the request that is forwarded gets it back.
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return f.next.RoundTrip(req)
+}
+
+func failure(status int, header ...string) *http.Response {
+	resp := &http.Response{
+		StatusCode: status,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(`{"message": "failure"}`)),
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		resp.Header.Set(header[i], header[i+1])
+	}
+	return resp
+}
+
+// newFailingTransport returns a rate limit transport in front of the failures and then the fake server for the basic
+// fixture.
+func newFailingTransport(t *testing.T, failures ...*http.Response) (*rateLimitTransport, *failingTransport, string) {
+	t.Helper()
+
+	fixture, err := fakediscord.LoadFixture("../fakediscord/testdata/basic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fakediscord.NewServer(fixture)
+	t.Cleanup(server.Close)
+
+	failing := &failingTransport{next: http.DefaultTransport, failures: failures}
+	transport := newRateLimitTransport(failing)
+	transport.retryDelay = time.Millisecond
+	return transport, failing, server.URL + "/api/v9/"
+}
+
+func TestRateLimitTransportRetries(t *testing.T) {
+	tests := []struct {
+		status   int
+		attempts int
+	}{
+		{http.StatusTooManyRequests, 2},
+		{http.StatusBadGateway, 2},
+		{http.StatusServiceUnavailable, 2},
+		{http.StatusGatewayTimeout, 2},
+		{http.StatusInternalServerError, 1},
+		{http.StatusForbidden, 1},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			transport, failing, baseURL := newFailingTransport(t, failure(tt.status))
+
+			req, err := http.NewRequest(http.MethodGet, baseURL+"guilds/100000000000000001", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if len(failing.bodies) != tt.attempts {
+				t.Errorf("made %d attempts, want %d", len(failing.bodies), tt.attempts)
+			}
+			want := tt.status
+			if tt.attempts > 1 {
+				want = http.StatusOK
+			}
+			if resp.StatusCode != want {
+				t.Errorf("status is %d, want %d", resp.StatusCode, want)
+			}
+		})
+	}
+}
+
+func TestRateLimitTransportGivesUpAfterMaxRetries(t *testing.T) {
+	var failures []*http.Response
+	for i := 0; i <= defaultMaxRetries; i++ {
+		failures = append(failures, failure(http.StatusServiceUnavailable))
+	}
+	transport, failing, baseURL := newFailingTransport(t, failures...)
+
+	req, err := http.NewRequest(http.MethodGet, baseURL+"guilds/100000000000000001", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status is %d, want the last failure", resp.StatusCode)
+	}
+	if len(failing.bodies) != defaultMaxRetries+1 {
+		t.Errorf("made %d attempts, want %d", len(failing.bodies), defaultMaxRetries+1)
+	}
+}
+
+func TestRateLimitTransportReplaysBody(t *testing.T) {
+	transport, failing, baseURL := newFailingTransport(t, failure(http.StatusTooManyRequests, "Retry-After", "0.001"))
+
+	body := `{"id":"200000000000000003","type":1,"allow":"1024","deny":"0"}`
+	req, err := http.NewRequest(http.MethodPut, baseURL+"channels/300000000000000003/permissions/200000000000000003", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status is %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if len(failing.bodies) != 2 || failing.bodies[0] != body || failing.bodies[1] != body {
+		t.Errorf("the attempts sent the bodies %q, want %q twice", failing.bodies, body)
+	}
+}
+
+func TestRateLimitTransportStopsWhenCanceled(t *testing.T) {
+	transport, failing, baseURL := newFailingTransport(t, failure(http.StatusTooManyRequests, "Retry-After", "30"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"guilds/100000000000000001", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = transport.RoundTrip(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error is %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s, long after the context ended", elapsed)
+	}
+	if len(failing.bodies) != 1 {
+		t.Errorf("made %d attempts, want 1", len(failing.bodies))
+	}
+}
+
+func TestRateLimitTransportBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []string
+		attempt int
+		want    time.Duration
+	}{
+		{"Retry-After", []string{"Retry-After", "2"}, 0, 2 * time.Second},
+		{"X-RateLimit-Reset-After", []string{"X-RateLimit-Reset-After", "1.5"}, 0, 1500 * time.Millisecond},
+		{"Retry-After over X-RateLimit-Reset-After", []string{"Retry-After", "3", "X-RateLimit-Reset-After", "1"}, 0, 3 * time.Second},
+		{"capped Retry-After", []string{"Retry-After", "120"}, 0, maxRetryDelay},
+		{"exponential", nil, 2, 4 * defaultRetryDelay},
+		{"capped exponential", nil, 20, maxRetryDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newRateLimitTransport(nil)
+			if got := transport.backoff(failure(http.StatusTooManyRequests, tt.header...), tt.attempt); got != tt.want {
+				t.Errorf("backoff is %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitTransportAnnotations(t *testing.T) {
+	transport := newRateLimitTransport(nil)
+	if annos := transport.annotations(); len(annos) != 0 {
+		t.Fatalf("annotations before any response: %v", annos)
+	}
+
+	observe := func(status int, header ...string) {
+		transport.observe(failure(status, header...))
+	}
+	constrained := func() *v2.RateLimitDescription {
+		t.Helper()
+		desc := &v2.RateLimitDescription{}
+		annos := transport.annotations()
+		ok, err := annos.Pick(desc)
+		if err != nil || !ok {
+			t.Fatalf("no rate limit description: %v", err)
+		}
+		return desc
+	}
+
+	observe(http.StatusOK, "X-RateLimit-Bucket", "a", "X-RateLimit-Limit", "10", "X-RateLimit-Remaining", "5", "X-RateLimit-Reset-After", "10")
+	observe(http.StatusOK, "X-RateLimit-Bucket", "b", "X-RateLimit-Limit", "4", "X-RateLimit-Remaining", "1", "X-RateLimit-Reset-After", "10")
+	observe(http.StatusOK, "X-RateLimit-Bucket", "c", "X-RateLimit-Limit", "50", "X-RateLimit-Remaining", "20", "X-RateLimit-Reset-After", "10")
+	// A bucket that has already reset is left out, however little it had remaining.
+	observe(http.StatusOK, "X-RateLimit-Bucket", "d", "X-RateLimit-Limit", "10", "X-RateLimit-Remaining", "0", "X-RateLimit-Reset-After", "0")
+	time.Sleep(time.Millisecond)
+	if desc := constrained(); desc.Limit != 4 || desc.Remaining != 1 {
+		t.Errorf("the most constrained bucket is %v, want the one with a quarter remaining", desc)
+	}
+
+	observe(http.StatusTooManyRequests, "X-RateLimit-Global", "true", "Retry-After", "10")
+	if desc := constrained(); desc.Status != v2.RateLimitDescription_STATUS_OVERLIMIT {
+		t.Errorf("the most constrained bucket is %v, want the one over its limit", desc)
+	}
+
+}
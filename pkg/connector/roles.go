@@ -2,8 +2,8 @@ package connector
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
@@ -23,11 +23,15 @@ var roleResourceType = &v2.ResourceType{
 }
 
 type roleBuilder struct {
-	conn *discordgo.Session
+	conn *sessions
+	*syncOptions
 
 	guildCache map[string]*discordgo.Guild
 	userCache  map[string]map[string]*discordgo.Member
-	roleCache  map[string]map[string]*discordgo.Role
+
+	// roleCache is filled concurrently while listing guilds, so it is guarded by roleMtx.
+	roleMtx   sync.Mutex
+	roleCache map[string]map[string]*discordgo.Role
 }
 
 func (r *roleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
@@ -46,6 +50,7 @@ func newRoleResource(role *discordgo.Role, guild *discordgo.Guild) (*v2.Resource
 		role.ID,
 		nil,
 		resource.WithParentResourceID(guildResource),
+		withExternalLink("channels", guild.ID),
 	)
 	if err != nil {
 		return nil, err
@@ -56,61 +61,97 @@ func newRoleResource(role *discordgo.Role, guild *discordgo.Guild) (*v2.Resource
 
 // List returns all the guilds from the database as resource objects.
 func (r *roleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	resources, err := listGuildResources(ctx, r.syncOptions, r.conn, r.listGuild)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return resources, "", r.annotations(), nil
+}
+
+func (r *roleBuilder) listGuild(guild *discordgo.Guild) ([]*v2.Resource, error) {
 	resources := []*v2.Resource{}
 
-	for _, guild := range r.conn.State.Guilds {
-		roles, err := r.conn.GuildRoles(guild.ID)
-		if err != nil {
-			return nil, "", nil, err
+	roles, roleIcons, err := r.fetchRoles(guild.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range roles {
+		if !r.roleFilter.Allows(role) {
+			continue
 		}
 
-		for _, role := range roles {
-			group, err := newRoleResource(role, guild)
-			if err != nil {
-				return nil, "", nil, err
-			}
-			resources = append(resources, group)
+		group, err := newRoleResource(role, guild)
+		if err != nil {
+			return nil, err
+		}
+		if icon := newAssetRef(assetKindRoleIcon, roleIcons[role.ID], role.ID); icon != nil {
+			annos := annotations.Annotations(group.Annotations)
+			annos.Append(icon)
+			group.Annotations = annos
 		}
+		resources = append(resources, group)
 	}
 
-	return resources, "", nil, nil
+	return resources, nil
 }
 
-func (r *roleBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+func (r *roleBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
 	role, err := r.getRole(resource.ParentResourceId.Resource, resource.Id.Resource)
 	if err != nil {
+		if r.skip(ctx, roleResourceTypeID, resource.Id.Resource, err) {
+			return nil, "", r.annotations(), nil
+		}
 		return nil, "", nil, fmt.Errorf("role not found: %w", err)
 	}
 
-	entitlements := []*v2.Entitlement{
-		newRoleAssignmentEntitlement(resource, role.Name),
+	membership := newRoleAssignmentEntitlement(resource, role.Name, r.grantableToMembers())
+	if isEveryoneRole(role, resource.ParentResourceId.Resource) {
+		membership = newEveryoneAssignmentEntitlement(resource, role.Name, r.grantableToMembers(guildResourceType))
 	}
-	for _, permission := range append(channelPermissions, guildPermissions...) {
+
+	entitlements := []*v2.Entitlement{membership}
+	for _, permission := range rolePermissions {
 		entitlements = append(
 			entitlements,
 			newRolePermissionEntitlement(
 				resource,
 				role.Name,
 				permission,
+				r.grantableToMembers(roleResourceType),
 			),
 		)
 	}
 
-	return entitlements, "", nil, nil
+	return entitlements, "", r.annotations(), nil
+}
+
+// newRoleAssignmentEntitlement is the membership of a role. It is grantable to users, unless other options say
+// otherwise.
+func newRoleAssignmentEntitlement(resource *v2.Resource, name string, opts ...entitlement.EntitlementOption) *v2.Entitlement {
+	return entitlement.NewAssignmentEntitlement(
+		resource,
+		fmt.Sprintf("Member of %s", name),
+		append([]entitlement.EntitlementOption{entitlement.WithGrantableTo(userResourceType)}, opts...)...,
+	)
 }
 
-func newRoleAssignmentEntitlement(resource *v2.Resource, name string) *v2.Entitlement {
+// newEveryoneAssignmentEntitlement is the membership of @everyone, which is granted to the guild and expanded to every
+// member through its access entitlement.
+func newEveryoneAssignmentEntitlement(resource *v2.Resource, name string, opts ...entitlement.EntitlementOption) *v2.Entitlement {
 	return entitlement.NewAssignmentEntitlement(
 		resource,
 		fmt.Sprintf("Member of %s", name),
-		entitlement.WithGrantableTo(userResourceType),
+		append([]entitlement.EntitlementOption{entitlement.WithGrantableTo(userResourceType, guildResourceType)}, opts...)...,
 	)
 }
-func newRolePermissionEntitlement(resource *v2.Resource, name string, permission int64) *v2.Entitlement {
+
+func newRolePermissionEntitlement(resource *v2.Resource, name string, permission int64, opts ...entitlement.EntitlementOption) *v2.Entitlement {
 	return entitlement.NewAssignmentEntitlement(
 		resource,
 		fmt.Sprintf("%s for %s", permNameFromVal[permission], name),
-		entitlement.WithGrantableTo(userResourceType),
+		append([]entitlement.EntitlementOption{entitlement.WithGrantableTo(userResourceType), withPermissionMetadata(permission)}, opts...)...,
 	)
 }
 
@@ -118,9 +159,9 @@ func (r *roleBuilder) getGuild(guildID string) (*discordgo.Guild, error) {
 	guild, ok := r.guildCache[guildID]
 	if !ok {
 		var err error
-		guild, err = r.conn.Guild(guildID)
+		guild, err = r.conn.forGuild(guildID).Guild(guildID)
 		if err != nil {
-			return nil, err
+			return nil, classifyError(err)
 		}
 		r.guildCache[guildID] = guild
 	}
@@ -132,13 +173,12 @@ func (r *roleBuilder) getMembers(guildID string) (map[string]*discordgo.Member,
 	userCache, ok := r.userCache[guildID]
 	if !ok {
 		userCache = make(map[string]*discordgo.Member)
-		r.userCache[guildID] = userCache
 
 		token := ""
 		for {
-			guildMembers, err := r.conn.GuildMembers(guildID, token, 1000)
+			guildMembers, err := r.conn.forGuild(guildID).GuildMembers(guildID, token, 1000)
 			if err != nil {
-				return nil, err
+				return nil, classifyError(err)
 			}
 
 			if len(guildMembers) == 0 {
@@ -151,34 +191,54 @@ func (r *roleBuilder) getMembers(guildID string) (map[string]*discordgo.Member,
 
 			token = guildMembers[len(guildMembers)-1].User.ID
 		}
+		r.userCache[guildID] = userCache
 	}
 
 	return userCache, nil
 }
 
 func (r *roleBuilder) getRole(guildID string, roleID string) (*discordgo.Role, error) {
+	if err := r.guildFilter.checkGuildID(r.conn, guildID); err != nil {
+		return nil, err
+	}
+
+	r.roleMtx.Lock()
 	roleCache, ok := r.roleCache[guildID]
+	r.roleMtx.Unlock()
 	if !ok {
-		roleCache = make(map[string]*discordgo.Role)
-		r.roleCache[guildID] = roleCache
-
-		roles, err := r.conn.GuildRoles(guildID)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, role := range roles {
-			roleCache[role.ID] = role
+		if _, _, err := r.fetchRoles(guildID); err != nil {
+			return nil, classifyError(err)
 		}
+		r.roleMtx.Lock()
+		roleCache = r.roleCache[guildID]
+		r.roleMtx.Unlock()
 	}
 
 	role, ok := roleCache[roleID]
 	if !ok {
-		return nil, errors.New("role not found")
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRole, roleID)
 	}
 	return role, nil
 }
 
+// fetchRoles fetches the roles of a guild with their icons, and caches the roles for their entitlements and grants.
+func (r *roleBuilder) fetchRoles(guildID string) ([]*discordgo.Role, map[string]string, error) {
+	roles, icons, err := guildRoles(r.conn.forGuild(guildID), guildID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roleCache := make(map[string]*discordgo.Role)
+	for _, role := range roles {
+		roleCache[role.ID] = role
+	}
+
+	r.roleMtx.Lock()
+	defer r.roleMtx.Unlock()
+	r.roleCache[guildID] = roleCache
+	return roles, icons, nil
+}
+
 func newRolePermissionGrant(resource *v2.Resource, guild *discordgo.Guild, role *discordgo.Role, permission int64) (*v2.Grant, error) {
 	rolePrincipal, err := newRoleResource(role, guild)
 	if err != nil {
@@ -192,26 +252,58 @@ func newRolePermissionGrant(resource *v2.Resource, guild *discordgo.Guild, role
 	), nil
 }
 
+func newEveryoneMembershipGrant(resource *v2.Resource, guild *discordgo.Guild, role *discordgo.Role) *v2.Grant {
+	guildResource := &v2.Resource{
+		Id: &v2.ResourceId{
+			ResourceType: guildResourceTypeID,
+			Resource:     guild.ID,
+		},
+	}
+
+	return grant.NewGrant(
+		resource,
+		newEveryoneAssignmentEntitlement(resource, role.Name).DisplayName,
+		guildResource.Id,
+		grant.WithAnnotation(&v2.GrantExpandable{
+			EntitlementIds: []string{
+				entitlement.NewEntitlementID(guildResource, guildAccessEntitlementName(guild.Name)),
+			},
+		}),
+		grant.WithGrantMetadata(map[string]interface{}{
+			"expansion": "All members",
+		}),
+	)
+}
+
 func (r *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
 	var grants []*v2.Grant
 
 	guildID := resource.ParentResourceId.Resource
 	guild, err := r.getGuild(guildID)
 	if err != nil {
+		if r.skip(ctx, guildResourceTypeID, guildID, err) {
+			return nil, "", r.annotations(), nil
+		}
 		return nil, "", nil, err
 	}
 
 	members, err := r.getMembers(guild.ID)
 	if err != nil {
+		if r.skip(ctx, guildResourceTypeID, guildID, err) {
+			return nil, "", r.annotations(), nil
+		}
 		return nil, "", nil, err
 	}
 
 	discordRole, err := r.getRole(guildID, resource.Id.Resource)
 	if err != nil {
+		if r.skip(ctx, roleResourceTypeID, resource.Id.Resource, err) {
+			return nil, "", r.annotations(), nil
+		}
 		return nil, "", nil, err
 	}
 
-	for _, permission := range channelPermissions {
+	for _, permission := range rolePermissions {
 		if discordRole.Permissions&permission != permission {
 			continue
 		}
@@ -229,13 +321,21 @@ func (r *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagi
 		grants = append(grants, role)
 	}
 
+	// Members never list @everyone in their roles, so membership is expanded from the guild's access entitlement.
+	if isEveryoneRole(discordRole, guild.ID) {
+		return append(grants, newEveryoneMembershipGrant(resource, guild, discordRole)), "", r.annotations(), nil
+	}
+
 	for _, member := range members {
-		userPrincipal, err := newMemberResource(member, guild)
+		if !contains(member.Roles, resource.Id.Resource) {
+			continue
+		}
+
+		userPrincipal, err := r.newMemberPrincipal(member, guild)
 		if err != nil {
 			return nil, "", nil, err
 		}
-
-		if !contains(member.Roles, resource.Id.Resource) {
+		if userPrincipal == nil {
 			continue
 		}
 
@@ -249,14 +349,96 @@ func (r *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagi
 		)
 	}
 
-	return grants, "", nil, nil
+	return grants, "", r.annotations(), nil
 }
 
-func newRoleBuilder(s *discordgo.Session) *roleBuilder {
+func newRoleBuilder(s *sessions, opts *syncOptions) *roleBuilder {
 	return &roleBuilder{
-		conn:       s,
-		guildCache: make(map[string]*discordgo.Guild),
-		userCache:  make(map[string]map[string]*discordgo.Member),
-		roleCache:  make(map[string]map[string]*discordgo.Role),
+		conn:        s,
+		syncOptions: opts,
+		guildCache:  make(map[string]*discordgo.Guild),
+		userCache:   make(map[string]map[string]*discordgo.Member),
+		roleCache:   make(map[string]map[string]*discordgo.Role),
+	}
+}
+
+// roleGuildID returns the ID of the guild of a role resource. Provisioning requests may leave out the parent, in which
+// case the guild is found from the roles the bots can see.
+func (r *roleBuilder) roleGuildID(resource *v2.Resource) (string, error) {
+	if resource.ParentResourceId != nil {
+		return resource.ParentResourceId.Resource, nil
+	}
+	for _, guild := range r.conn.guilds() {
+		for _, role := range guild.Roles {
+			if role.ID == resource.Id.Resource {
+				return guild.ID, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownRole, resource.Id.Resource)
+}
+
+// provisionedRole returns the role whose membership the entitlement is, refusing the entitlements that can't be
+// provisioned: role permissions, which come from the role itself, and the roles Discord assigns automatically.
+func (r *roleBuilder) provisionedRole(en *v2.Entitlement) (string, *discordgo.Role, error) {
+	guildID, err := r.roleGuildID(en.Resource)
+	if err != nil {
+		return "", nil, err
+	}
+	role, err := r.getRole(guildID, en.Resource.Id.Resource)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch {
+	case en.Id != newRoleAssignmentEntitlement(en.Resource, role.Name).Id:
+		return "", nil, fmt.Errorf("only membership of role %s can be provisioned, not %s", role.Name, en.DisplayName)
+	case isEveryoneRole(role, guildID):
+		return "", nil, fmt.Errorf("every member holds role %s", role.Name)
+	case role.Managed:
+		return "", nil, fmt.Errorf("role %s is managed by an integration", role.Name)
+	}
+	return guildID, role, nil
+}
+
+// checkMemberPrincipal returns an error unless the principal is a guild member, as a user or a bot.
+func checkMemberPrincipal(principal *v2.Resource) error {
+	switch principal.Id.ResourceType {
+	case userResourceTypeID, botResourceType.Id:
+		return nil
+	default:
+		return fmt.Errorf("a %s can't be a member of a role", principal.Id.ResourceType)
+	}
+}
+
+// Grant adds the principal to the role, through the bot with the most permissions in the guild.
+func (r *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, en *v2.Entitlement) (annotations.Annotations, error) {
+	if err := checkMemberPrincipal(principal); err != nil {
+		return nil, err
+	}
+	guildID, role, err := r.provisionedRole(en)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.conn.forGuild(guildID).GuildMemberRoleAdd(guildID, principal.Id.Resource, role.ID); err != nil {
+		return nil, classifyError(err)
+	}
+	return nil, nil
+}
+
+// Revoke removes the principal from the role. Removing a member who doesn't hold the role succeeds.
+func (r *roleBuilder) Revoke(ctx context.Context, g *v2.Grant) (annotations.Annotations, error) {
+	if err := checkMemberPrincipal(g.Principal); err != nil {
+		return nil, err
+	}
+	guildID, role, err := r.provisionedRole(g.Entitlement)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.conn.forGuild(guildID).GuildMemberRoleRemove(guildID, g.Principal.Id.Resource, role.ID); err != nil {
+		return nil, classifyError(err)
 	}
+	return nil, nil
 }
@@ -0,0 +1,203 @@
+package connector
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// defaultBotName is the name of the bot whose token is passed to New.
+const defaultBotName = "default"
+
+// botSession is the session of one of the configured bot tokens.
+type botSession struct {
+	name    string
+	session *discordgo.Session
+	source  TokenSource
+
+	// sentAuthorization is the Authorization header discordgo sets on the requests of the session. The session's token
+	// is never changed, since discordgo reads it without locking, so requests are sent with authorization instead.
+	sentAuthorization string
+
+	// mtx guards authorization, and serializes re-reading the token.
+	mtx           sync.Mutex
+	authorization string
+}
+
+func newBotSession(name string, session *discordgo.Session, source TokenSource) *botSession {
+	return &botSession{
+		name:              name,
+		session:           session,
+		source:            source,
+		sentAuthorization: session.Token,
+		authorization:     session.Token,
+	}
+}
+
+// sessions holds a session for every configured bot, and picks the one to use in each guild. Guilds visible to more
+// than one bot are synced once, through the bot with the most permissions in the guild. The same bot is used for
+// provisioning in the guild.
+type sessions struct {
+	bots []*botSession
+
+	// mtx guards chosen. It is never held while a bot is chosen, which may fetch the bot's member from Discord.
+	mtx    sync.Mutex
+	chosen map[string]*guildChoice
+}
+
+// guildChoice is the bot chosen for a guild, which is chosen once.
+type guildChoice struct {
+	once sync.Once
+	bot  *botSession
+}
+
+func newSessions(bots []*botSession) *sessions {
+	return &sessions{bots: bots, chosen: make(map[string]*guildChoice)}
+}
+
+// names returns the names of the bots, in the order they were configured.
+func (s *sessions) names() []string {
+	names := make([]string, 0, len(s.bots))
+	for _, bot := range s.bots {
+		names = append(names, bot.name)
+	}
+	return names
+}
+
+// any returns a session for requests that aren't specific to a guild.
+func (s *sessions) any() *discordgo.Session {
+	return s.bots[0].session
+}
+
+// guilds returns the guilds visible to any of the bots, once each and ordered by ID.
+func (s *sessions) guilds() []*discordgo.Guild {
+	seen := make(map[string]bool)
+	guilds := []*discordgo.Guild{}
+	for _, bot := range s.bots {
+		bot.session.State.RLock()
+		for _, guild := range bot.session.State.Guilds {
+			if !seen[guild.ID] {
+				seen[guild.ID] = true
+				guilds = append(guilds, guild)
+			}
+		}
+		bot.session.State.RUnlock()
+	}
+	sort.Slice(guilds, func(i, j int) bool {
+		return guilds[i].ID < guilds[j].ID
+	})
+	return guilds
+}
+
+// stateGuild returns the guild from the state of the first bot that can see it.
+func (s *sessions) stateGuild(guildID string) (*discordgo.Guild, error) {
+	var err error
+	for _, bot := range s.bots {
+		var guild *discordgo.Guild
+		if guild, err = bot.session.State.Guild(guildID); err == nil {
+			return guild, nil
+		}
+	}
+	return nil, err
+}
+
+// forGuild returns the session of the bot with the most permissions in the guild.
+func (s *sessions) forGuild(guildID string) *discordgo.Session {
+	if len(s.bots) == 1 {
+		return s.any()
+	}
+
+	s.mtx.Lock()
+	choice, ok := s.chosen[guildID]
+	if !ok {
+		choice = &guildChoice{}
+		s.chosen[guildID] = choice
+	}
+	s.mtx.Unlock()
+
+	// Only callers in the same guild wait for the bots to be scored.
+	choice.once.Do(func() {
+		choice.bot = s.bestBot(guildID)
+	})
+	if choice.bot == nil {
+		// None of the bots has the guild in its state yet, so choose again next time.
+		s.mtx.Lock()
+		if s.chosen[guildID] == choice {
+			delete(s.chosen, guildID)
+		}
+		s.mtx.Unlock()
+		return s.any()
+	}
+	return choice.bot.session
+}
+
+// bestBot returns the bot with the most permissions in the guild, or nil if none of the bots can see it.
+func (s *sessions) bestBot(guildID string) *botSession {
+	var best *botSession
+	bestScore := -1
+	for _, bot := range s.bots {
+		guild, err := bot.session.State.Guild(guildID)
+		if err != nil {
+			continue
+		}
+		if score := botPermissionScore(bot.session, guild); best == nil || score > bestScore {
+			best, bestScore = bot, score
+		}
+	}
+	return best
+}
+
+// channel returns the channel through the session of its guild. Channels that aren't in the state of any bot are
+// looked up by each bot in turn, to find the guild they belong to.
+func (s *sessions) channel(channelID string) (*discordgo.Channel, error) {
+	for _, bot := range s.bots {
+		if channel, err := bot.session.State.Channel(channelID); err == nil {
+			return s.forGuild(channel.GuildID).Channel(channelID)
+		}
+	}
+
+	var err error
+	for _, bot := range s.bots {
+		var channel *discordgo.Channel
+		if channel, err = bot.session.Channel(channelID); err != nil {
+			continue
+		}
+		if session := s.forGuild(channel.GuildID); session != bot.session {
+			return session.Channel(channelID)
+		}
+		return channel, nil
+	}
+	return nil, err
+}
+
+// botPermissionScore ranks the bot of the session by the number of guild permissions it holds. Owners and
+// administrators hold every permission.
+func botPermissionScore(session *discordgo.Session, guild *discordgo.Guild) int {
+	if session.State.User == nil {
+		return 0
+	}
+	botID := session.State.User.ID
+	if guild.OwnerID == botID {
+		return bits.OnesCount64(uint64(discordgo.PermissionAll))
+	}
+
+	member, err := session.State.Member(guild.ID, botID)
+	if err != nil {
+		if member, err = session.GuildMember(guild.ID, botID); err != nil {
+			return 0
+		}
+	}
+
+	var perms int64
+	for _, role := range guild.Roles {
+		if role.ID == guild.ID || contains(member.Roles, role.ID) {
+			perms |= role.Permissions
+		}
+	}
+	if perms&discordgo.PermissionAdministrator == discordgo.PermissionAdministrator {
+		perms = discordgo.PermissionAll
+	}
+	return bits.OnesCount64(uint64(perms))
+}
@@ -1,7 +1,13 @@
 package connector
 
 import (
+	"strings"
+
 	"github.com/bwmarrin/discordgo"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	resource_sdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 var guildPermissions = []int64{
@@ -23,9 +29,30 @@ var guildPermissions = []int64{
 	discordgo.PermissionModerateMembers,
 }
 
-var channelPermissions = append(textChannelPermissions, voiceChannelPermissions...)
+var channelPermissions = append(append([]int64{}, textChannelPermissions...), voiceChannelPermissions...)
+
+// rolePermissions is every permission a role advertises an entitlement for.
+var rolePermissions = appendMissing(append([]int64{}, channelPermissions...), guildPermissions...)
+
+// dangerousPermissions are permissions that allow a holder to take over or disrupt a guild.
+var dangerousPermissions = []int64{
+	discordgo.PermissionAdministrator,
+	discordgo.PermissionManageServer,
+	discordgo.PermissionManageRoles,
+	discordgo.PermissionManageWebhooks,
+	discordgo.PermissionBanMembers,
+}
+
+// guildChannelPermissions are the guild permissions that channel overwrites can also allow or deny.
+var guildChannelPermissions = []int64{
+	discordgo.PermissionViewChannel,
+	discordgo.PermissionManageChannels,
+	discordgo.PermissionManageRoles,
+	discordgo.PermissionCreateInstantInvite,
+	discordgo.PermissionAddReactions,
+}
 
-var textChannelPermissions = []int64{
+var textChannelPermissions = append(append([]int64{}, guildChannelPermissions...),
 	discordgo.PermissionSendMessages,
 	discordgo.PermissionSendTTSMessages,
 	discordgo.PermissionManageMessages,
@@ -42,7 +69,7 @@ var textChannelPermissions = []int64{
 	discordgo.PermissionSendMessagesInThreads,
 	discordgo.PermissionUseActivities,
 	discordgo.PermissionManageWebhooks,
-}
+)
 
 var voiceChannelPermissions = []int64{
 	discordgo.PermissionVoicePrioritySpeaker,
@@ -100,6 +127,71 @@ var permNameFromVal = map[int64]string{
 	discordgo.PermissionModerateMembers:       "ModerateMembers",
 }
 
+// withPermissionMetadata annotates a permission entitlement with metadata describing the permission, including
+// whether it is considered dangerous.
+func withPermissionMetadata(permission int64) entitlement.EntitlementOption {
+	return entitlement.WithAnnotation(&structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"permission": structpb.NewStringValue(permNameFromVal[permission]),
+			"dangerous":  structpb.NewBoolValue(contains(dangerousPermissions, permission)),
+		},
+	})
+}
+
+// grantableToMembers makes an entitlement grantable to the members of a guild, which are bots as well as users when
+// bots are synced separately, and to the other resource types given.
+func (o *syncOptions) grantableToMembers(others ...*v2.ResourceType) entitlement.EntitlementOption {
+	types := []*v2.ResourceType{userResourceType}
+	if o.botMode == BotModeSeparate {
+		types = append(types, botResourceType)
+	}
+	return entitlement.WithGrantableTo(append(types, others...)...)
+}
+
+// withProfile attaches the profile of a resource whose type the SDK has no trait for, such as a scheduled event. The
+// profile is the single "profile" field of a Struct annotation, the same way user and group traits hold theirs.
+func withProfile(profile map[string]interface{}) resource_sdk.ResourceOption {
+	return func(r *v2.Resource) error {
+		annotation, err := structpb.NewStruct(map[string]interface{}{
+			"profile": profile,
+		})
+		if err != nil {
+			return err
+		}
+		return resource_sdk.WithAnnotation(annotation)(r)
+	}
+}
+
+// newReport returns a report attached to sync responses, such as the objects skipped so far. Every report is a Struct
+// annotation with a single field, named after the report, listing its entries, so that reports can be told apart from
+// each other and from the rate limit annotations.
+func newReport(name string, entries []interface{}) (*structpb.Struct, error) {
+	return structpb.NewStruct(map[string]interface{}{
+		name: entries,
+	})
+}
+
+// discordURL is the base of every link to the Discord web client.
+const discordURL = "https://discord.com"
+
+// withExternalLink links a resource to the Discord web client. Channels and threads live at channels/<guild>/<channel>,
+// guilds (and the roles managed from their settings) at channels/<guild>, and users at users/<user>.
+func withExternalLink(path ...string) resource_sdk.ResourceOption {
+	return resource_sdk.WithAnnotation(&v2.ExternalLink{
+		Url: strings.Join(append([]string{discordURL}, path...), "/"),
+	})
+}
+
+// appendMissing appends the items that aren't in the slice yet.
+func appendMissing[T comparable](slice []T, items ...T) []T {
+	for _, item := range items {
+		if !contains(slice, item) {
+			slice = append(slice, item)
+		}
+	}
+	return slice
+}
+
 func contains[T comparable](slice []T, item T) bool {
 	for _, s := range slice {
 		if s == item {
@@ -0,0 +1,422 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/ConductorOne/baton-discord/pkg/snowflake"
+)
+
+// TemplateVersion is the version of the access template format written by Template. Templates of any other version
+// are rejected by CheckTemplateVersion.
+const TemplateVersion = 1
+
+// AccessTemplate is a declarative snapshot of the access configuration of a guild: its roles and their permissions,
+// and its categories and channels with their permission overwrites. Permissions are listed by name, and permissions
+// without a name yet by their bit, e.g. bit:40.
+type AccessTemplate struct {
+	Version    int                `json:"version" yaml:"version"`
+	Guild      TemplateGuild      `json:"guild" yaml:"guild"`
+	Roles      []*TemplateRole    `json:"roles" yaml:"roles"`
+	Categories []*TemplateChannel `json:"categories" yaml:"categories"`
+	Channels   []*TemplateChannel `json:"channels" yaml:"channels"`
+}
+
+// TemplateGuild identifies the guild an access template was taken from.
+type TemplateGuild struct {
+	ID   string `json:"id" yaml:"id"`
+	Name string `json:"name" yaml:"name"`
+}
+
+// TemplateRole is a role of an access template.
+type TemplateRole struct {
+	ID          string   `json:"id" yaml:"id"`
+	Name        string   `json:"name" yaml:"name"`
+	Position    int      `json:"position" yaml:"position"`
+	Managed     bool     `json:"managed,omitempty" yaml:"managed,omitempty"`
+	Permissions []string `json:"permissions" yaml:"permissions"`
+}
+
+// TemplateChannel is a category or channel of an access template. Category is the ID of the channel's category.
+type TemplateChannel struct {
+	ID         string               `json:"id" yaml:"id"`
+	Name       string               `json:"name" yaml:"name"`
+	Type       string               `json:"type" yaml:"type"`
+	Category   string               `json:"category,omitempty" yaml:"category,omitempty"`
+	Position   int                  `json:"position" yaml:"position"`
+	Overwrites []*TemplateOverwrite `json:"overwrites,omitempty" yaml:"overwrites,omitempty"`
+}
+
+// TemplateOverwrite is a permission overwrite of a category or channel, for a role or a member. Name is only set for
+// roles.
+type TemplateOverwrite struct {
+	Type  string   `json:"type" yaml:"type"`
+	ID    string   `json:"id" yaml:"id"`
+	Name  string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+}
+
+var channelTypeNames = map[discordgo.ChannelType]string{
+	discordgo.ChannelTypeGuildText:       "text",
+	discordgo.ChannelTypeGuildVoice:      "voice",
+	discordgo.ChannelTypeGuildCategory:   "category",
+	discordgo.ChannelTypeGuildNews:       "announcement",
+	discordgo.ChannelTypeGuildStore:      "store",
+	discordgo.ChannelTypeGuildStageVoice: "stage",
+	discordgo.ChannelTypeGuildForum:      "forum",
+}
+
+var overwriteTypeNames = map[discordgo.PermissionOverwriteType]string{
+	discordgo.PermissionOverwriteTypeRole:   "role",
+	discordgo.PermissionOverwriteTypeMember: "member",
+}
+
+// templatePermissions is every known permission, in the order of their bits.
+var templatePermissions = func() []int64 {
+	perms := make([]int64, 0, len(permNameFromVal))
+	for permission := range permNameFromVal {
+		perms = append(perms, permission)
+	}
+	sort.Slice(perms, func(i, j int) bool {
+		return perms[i] < perms[j]
+	})
+	return perms
+}()
+
+// unknownPermissionPrefix names permission bits that aren't known yet, e.g. bit:40, so that they are kept in templates
+// and show up in diffs.
+const unknownPermissionPrefix = "bit:"
+
+// templatePermissionNames returns the names of the permissions set in the bitmask, known permissions first.
+func templatePermissionNames(bitmask int64) []string {
+	names := permissionNames(bitmask, templatePermissions)
+	for bit := 0; bit < 64; bit++ {
+		permission := int64(1) << bit
+		if bitmask&permission == permission && permNameFromVal[permission] == "" {
+			names = append(names, unknownPermissionPrefix+strconv.Itoa(bit))
+		}
+	}
+	return names
+}
+
+// templatePermissionValue returns the bit of a permission named in a template.
+func templatePermissionValue(name string) (int64, bool) {
+	if permission, ok := permValFromName[name]; ok {
+		return permission, true
+	}
+	bit, err := strconv.Atoi(strings.TrimPrefix(name, unknownPermissionPrefix))
+	if !strings.HasPrefix(name, unknownPermissionPrefix) || err != nil || bit < 0 || bit > 63 {
+		return 0, false
+	}
+	return int64(1) << bit, true
+}
+
+// CheckTemplateVersion returns an error if the template was written in a format this version can't compare.
+func CheckTemplateVersion(template *AccessTemplate) error {
+	if template.Version != TemplateVersion {
+		return fmt.Errorf("unsupported access template version %d, expected %d", template.Version, TemplateVersion)
+	}
+	return nil
+}
+
+// Template takes an access template of the guild. Roles and channels excluded by the filters are left out, as are
+// the overwrites of excluded roles. A category is included if the filter allows it or any of its channels.
+func (d *Connector) Template(ctx context.Context, guildID string) (*AccessTemplate, error) {
+	if err := d.opts.guildFilter.checkGuildID(d.conn, guildID); err != nil {
+		return nil, err
+	}
+
+	s := d.conn.forGuild(guildID)
+	guild, err := s.Guild(guildID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	roles, err := s.GuildRoles(guildID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	channels, err := s.GuildChannels(guildID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	template := &AccessTemplate{
+		Version:    TemplateVersion,
+		Guild:      TemplateGuild{ID: guild.ID, Name: guild.Name},
+		Roles:      []*TemplateRole{},
+		Categories: []*TemplateChannel{},
+		Channels:   []*TemplateChannel{},
+	}
+
+	rolesByID := make(map[string]*discordgo.Role)
+	for _, role := range roles {
+		if !d.opts.roleFilter.Allows(role) {
+			continue
+		}
+		rolesByID[role.ID] = role
+		template.Roles = append(template.Roles, &TemplateRole{
+			ID:          role.ID,
+			Name:        role.Name,
+			Position:    role.Position,
+			Managed:     role.Managed,
+			Permissions: templatePermissionNames(role.Permissions),
+		})
+	}
+	sort.Slice(template.Roles, func(i, j int) bool {
+		return templateLess(template.Roles[i].Position, template.Roles[i].ID, template.Roles[j].Position, template.Roles[j].ID)
+	})
+
+	categories := make(map[string]*discordgo.Channel)
+	for _, channel := range channels {
+		if channel.Type == discordgo.ChannelTypeGuildCategory {
+			categories[channel.ID] = channel
+		}
+	}
+
+	includedCategories := make(map[string]bool)
+	for _, channel := range channels {
+		if channel.Type == discordgo.ChannelTypeGuildCategory {
+			if d.opts.channelFilter.Allows(channel, channel) {
+				includedCategories[channel.ID] = true
+			}
+			continue
+		}
+		if !d.opts.channelFilter.Allows(channel, categories[channel.ParentID]) {
+			continue
+		}
+		if channel.ParentID != "" {
+			includedCategories[channel.ParentID] = true
+		}
+		template.Channels = append(template.Channels, newTemplateChannel(channel, rolesByID))
+	}
+	for id := range includedCategories {
+		if category, ok := categories[id]; ok {
+			template.Categories = append(template.Categories, newTemplateChannel(category, rolesByID))
+		}
+	}
+
+	for _, list := range [][]*TemplateChannel{template.Categories, template.Channels} {
+		sort.Slice(list, func(i, j int) bool {
+			return templateLess(list[i].Position, list[i].ID, list[j].Position, list[j].ID)
+		})
+	}
+
+	return template, nil
+}
+
+func newTemplateChannel(channel *discordgo.Channel, rolesByID map[string]*discordgo.Role) *TemplateChannel {
+	templateChannel := &TemplateChannel{
+		ID:       channel.ID,
+		Name:     channel.Name,
+		Type:     enumName(channelTypeNames, channel.Type),
+		Category: channel.ParentID,
+		Position: channel.Position,
+	}
+
+	for _, overwrite := range channel.PermissionOverwrites {
+		templateOverwrite := &TemplateOverwrite{
+			Type:  enumName(overwriteTypeNames, overwrite.Type),
+			ID:    overwrite.ID,
+			Allow: templatePermissionNames(overwrite.Allow),
+			Deny:  templatePermissionNames(overwrite.Deny),
+		}
+		if overwrite.Type == discordgo.PermissionOverwriteTypeRole {
+			role, ok := rolesByID[overwrite.ID]
+			if !ok {
+				continue
+			}
+			templateOverwrite.Name = role.Name
+		}
+		templateChannel.Overwrites = append(templateChannel.Overwrites, templateOverwrite)
+	}
+	sort.Slice(templateChannel.Overwrites, func(i, j int) bool {
+		a, b := templateChannel.Overwrites[i], templateChannel.Overwrites[j]
+		if a.Type != b.Type {
+			return a.Type > b.Type
+		}
+		return snowflake.Less(a.ID, b.ID)
+	})
+
+	return templateChannel
+}
+
+// templateLess orders roles and channels by position, then by ID, which Discord uses to break ties.
+func templateLess(positionA int, idA string, positionB int, idB string) bool {
+	if positionA != positionB {
+		return positionA < positionB
+	}
+	return snowflake.Less(idA, idB)
+}
+
+// Drift is a difference between a saved access template and the current state of the guild.
+type Drift struct {
+	// Object describes what changed, e.g. "role Moderators (110000000000000001)".
+	Object string
+	// Change is what happened to it, e.g. "added" or "permissions changed".
+	Change string
+	// Details lists the individual changes, such as permissions added with + and removed with -.
+	Details []string
+}
+
+func (d Drift) String() string {
+	if len(d.Details) == 0 {
+		return fmt.Sprintf("%s: %s", d.Object, d.Change)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Object, d.Change, strings.Join(d.Details, " "))
+}
+
+// DiffTemplates reports how the current template has drifted from the saved one. Roles, channels and overwrites are
+// matched by ID. Positions aren't compared, since adding a single role or channel moves every other one.
+func DiffTemplates(saved *AccessTemplate, current *AccessTemplate) []Drift {
+	var drifts []Drift
+
+	currentRoles := make(map[string]*TemplateRole)
+	for _, role := range current.Roles {
+		currentRoles[role.ID] = role
+	}
+	savedRoles := make(map[string]*TemplateRole)
+	for _, role := range saved.Roles {
+		savedRoles[role.ID] = role
+
+		object := fmt.Sprintf("role %s (%s)", role.Name, role.ID)
+		currentRole, ok := currentRoles[role.ID]
+		if !ok {
+			drifts = append(drifts, Drift{Object: object, Change: "removed"})
+			continue
+		}
+		if currentRole.Name != role.Name {
+			drifts = append(drifts, Drift{Object: object, Change: fmt.Sprintf("renamed to %s", currentRole.Name)})
+		}
+		if details := diffPermissions(role.Permissions, currentRole.Permissions); len(details) > 0 {
+			drifts = append(drifts, Drift{Object: object, Change: "permissions changed", Details: details})
+		}
+	}
+	for _, role := range current.Roles {
+		if _, ok := savedRoles[role.ID]; !ok {
+			drifts = append(drifts, Drift{
+				Object:  fmt.Sprintf("role %s (%s)", role.Name, role.ID),
+				Change:  "added",
+				Details: prefixAll("+", role.Permissions),
+			})
+		}
+	}
+
+	drifts = append(drifts, diffTemplateChannels("category", saved.Categories, current.Categories)...)
+	drifts = append(drifts, diffTemplateChannels("channel", saved.Channels, current.Channels)...)
+
+	return drifts
+}
+
+func diffTemplateChannels(kind string, saved []*TemplateChannel, current []*TemplateChannel) []Drift {
+	var drifts []Drift
+
+	currentChannels := make(map[string]*TemplateChannel)
+	for _, channel := range current {
+		currentChannels[channel.ID] = channel
+	}
+	savedChannels := make(map[string]*TemplateChannel)
+	for _, channel := range saved {
+		savedChannels[channel.ID] = channel
+
+		object := fmt.Sprintf("%s %s (%s)", kind, channel.Name, channel.ID)
+		currentChannel, ok := currentChannels[channel.ID]
+		if !ok {
+			drifts = append(drifts, Drift{Object: object, Change: "removed"})
+			continue
+		}
+		if currentChannel.Name != channel.Name {
+			drifts = append(drifts, Drift{Object: object, Change: fmt.Sprintf("renamed to %s", currentChannel.Name)})
+		}
+		switch {
+		case currentChannel.Category == channel.Category:
+		case currentChannel.Category == "":
+			drifts = append(drifts, Drift{Object: object, Change: "moved out of its category"})
+		default:
+			drifts = append(drifts, Drift{Object: object, Change: fmt.Sprintf("moved to category %s", currentChannel.Category)})
+		}
+		drifts = append(drifts, diffTemplateOverwrites(object, channel.Overwrites, currentChannel.Overwrites)...)
+	}
+	for _, channel := range current {
+		if _, ok := savedChannels[channel.ID]; !ok {
+			drifts = append(drifts, Drift{Object: fmt.Sprintf("%s %s (%s)", kind, channel.Name, channel.ID), Change: "added"})
+		}
+	}
+
+	return drifts
+}
+
+func diffTemplateOverwrites(channelObject string, saved []*TemplateOverwrite, current []*TemplateOverwrite) []Drift {
+	var drifts []Drift
+
+	key := func(overwrite *TemplateOverwrite) string {
+		return overwrite.Type + ":" + overwrite.ID
+	}
+	object := func(overwrite *TemplateOverwrite) string {
+		if overwrite.Name != "" {
+			return fmt.Sprintf("%s: overwrite for %s %s (%s)", channelObject, overwrite.Type, overwrite.Name, overwrite.ID)
+		}
+		return fmt.Sprintf("%s: overwrite for %s %s", channelObject, overwrite.Type, overwrite.ID)
+	}
+	overwriteDetails := func(overwrite *TemplateOverwrite) []string {
+		return append(prefixAll("allow:", overwrite.Allow), prefixAll("deny:", overwrite.Deny)...)
+	}
+
+	currentOverwrites := make(map[string]*TemplateOverwrite)
+	for _, overwrite := range current {
+		currentOverwrites[key(overwrite)] = overwrite
+	}
+	savedOverwrites := make(map[string]*TemplateOverwrite)
+	for _, overwrite := range saved {
+		savedOverwrites[key(overwrite)] = overwrite
+
+		currentOverwrite, ok := currentOverwrites[key(overwrite)]
+		if !ok {
+			drifts = append(drifts, Drift{Object: object(overwrite), Change: "removed", Details: overwriteDetails(overwrite)})
+			continue
+		}
+		details := append(
+			prefixAll("allow:", diffPermissions(overwrite.Allow, currentOverwrite.Allow)),
+			prefixAll("deny:", diffPermissions(overwrite.Deny, currentOverwrite.Deny))...,
+		)
+		if len(details) > 0 {
+			drifts = append(drifts, Drift{Object: object(overwrite), Change: "changed", Details: details})
+		}
+	}
+	for _, overwrite := range current {
+		if _, ok := savedOverwrites[key(overwrite)]; !ok {
+			drifts = append(drifts, Drift{Object: object(overwrite), Change: "added", Details: overwriteDetails(overwrite)})
+		}
+	}
+
+	return drifts
+}
+
+// diffPermissions lists the permissions added to current with a + and those removed from saved with a -.
+func diffPermissions(saved []string, current []string) []string {
+	var details []string
+	for _, permission := range current {
+		if !contains(saved, permission) {
+			details = append(details, "+"+permission)
+		}
+	}
+	for _, permission := range saved {
+		if !contains(current, permission) {
+			details = append(details, "-"+permission)
+		}
+	}
+	return details
+}
+
+func prefixAll(prefix string, values []string) []string {
+	prefixed := make([]string, 0, len(values))
+	for _, value := range values {
+		prefixed = append(prefixed, prefix+value)
+	}
+	return prefixed
+}
@@ -0,0 +1,115 @@
+package connector_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ConductorOne/baton-discord/pkg/connector"
+	"github.com/ConductorOne/baton-discord/pkg/fakediscord"
+)
+
+func TestTemplateKeepsUnknownPermissions(t *testing.T) {
+	fixture, err := fakediscord.LoadFixture(basicFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range fixture.Guilds[0].Roles {
+		if role.ID == moderatorsID {
+			role.Permissions |= 1 << 46
+		}
+	}
+	cb, _ := newFixtureConnector(t, fixture)
+
+	template, err := cb.Template(testContext(), guildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range template.Roles {
+		if role.ID != moderatorsID {
+			continue
+		}
+		if got := role.Permissions[len(role.Permissions)-1]; got != "bit:46" {
+			t.Errorf("the last permission of Moderators is %s, want bit:46", got)
+		}
+		return
+	}
+	t.Fatal("Moderators aren't in the template")
+}
+
+func TestDiffTemplates(t *testing.T) {
+	role := func(id, name string, permissions ...string) *connector.TemplateRole {
+		return &connector.TemplateRole{ID: id, Name: name, Permissions: permissions}
+	}
+	channel := func(name string, overwrites ...*connector.TemplateOverwrite) *connector.TemplateChannel {
+		return &connector.TemplateChannel{ID: "300", Name: name, Type: "text", Overwrites: overwrites}
+	}
+	overwrite := func(allow, deny []string) *connector.TemplateOverwrite {
+		return &connector.TemplateOverwrite{Type: "role", ID: "110", Name: "Moderators", Allow: allow, Deny: deny}
+	}
+
+	tests := []struct {
+		name    string
+		saved   *connector.AccessTemplate
+		current *connector.AccessTemplate
+		want    []string
+	}{
+		{
+			name:    "unchanged",
+			saved:   &connector.AccessTemplate{Roles: []*connector.TemplateRole{role("110", "Moderators", "KickMembers")}},
+			current: &connector.AccessTemplate{Roles: []*connector.TemplateRole{role("110", "Moderators", "KickMembers")}},
+		},
+		{
+			name:    "role added",
+			saved:   &connector.AccessTemplate{},
+			current: &connector.AccessTemplate{Roles: []*connector.TemplateRole{role("110", "Moderators", "KickMembers", "bit:46")}},
+			want:    []string{"role Moderators (110): added: +KickMembers +bit:46"},
+		},
+		{
+			name:    "role removed",
+			saved:   &connector.AccessTemplate{Roles: []*connector.TemplateRole{role("110", "Moderators", "KickMembers")}},
+			current: &connector.AccessTemplate{},
+			want:    []string{"role Moderators (110): removed"},
+		},
+		{
+			name:    "role renamed",
+			saved:   &connector.AccessTemplate{Roles: []*connector.TemplateRole{role("110", "Moderators", "KickMembers")}},
+			current: &connector.AccessTemplate{Roles: []*connector.TemplateRole{role("110", "Mods", "KickMembers")}},
+			want:    []string{"role Moderators (110): renamed to Mods"},
+		},
+		{
+			name:    "role permissions changed",
+			saved:   &connector.AccessTemplate{Roles: []*connector.TemplateRole{role("110", "Moderators", "KickMembers", "bit:46")}},
+			current: &connector.AccessTemplate{Roles: []*connector.TemplateRole{role("110", "Moderators", "BanMembers")}},
+			want:    []string{"role Moderators (110): permissions changed: +BanMembers -KickMembers -bit:46"},
+		},
+		{
+			name: "overwrite changed",
+			saved: &connector.AccessTemplate{Channels: []*connector.TemplateChannel{
+				channel("general", overwrite([]string{"ViewChannel"}, []string{"SendMessages"})),
+			}},
+			current: &connector.AccessTemplate{Channels: []*connector.TemplateChannel{
+				channel("general", overwrite([]string{"ViewChannel", "ManageMessages"}, nil)),
+			}},
+			want: []string{"channel general (300): overwrite for role Moderators (110): changed: allow:+ManageMessages deny:-SendMessages"},
+		},
+		{
+			name: "overwrite removed",
+			saved: &connector.AccessTemplate{Channels: []*connector.TemplateChannel{
+				channel("general", overwrite([]string{"ViewChannel"}, []string{"SendMessages"})),
+			}},
+			current: &connector.AccessTemplate{Channels: []*connector.TemplateChannel{channel("general")}},
+			want:    []string{"channel general (300): overwrite for role Moderators (110): removed: allow:ViewChannel deny:SendMessages"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, drift := range connector.DiffTemplates(tt.saved, tt.current) {
+				got = append(got, drift.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffTemplates() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
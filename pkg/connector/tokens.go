@@ -0,0 +1,125 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// TokenSource returns the current token of a bot, for example by reading a mounted secret. It is called when the
+// connector starts, and again whenever Discord rejects the token, so that rotated tokens are picked up without a
+// restart.
+type TokenSource func(ctx context.Context) (string, error)
+
+// staticToken returns a TokenSource for a token that never changes.
+func staticToken(token string) TokenSource {
+	return func(context.Context) (string, error) {
+		return token, nil
+	}
+}
+
+// bot returns the bot whose session sends the Authorization header, or nil if none does.
+func (s *sessions) bot(sentAuthorization string) *botSession {
+	for _, bot := range s.bots {
+		if bot.sentAuthorization == sentAuthorization {
+			return bot
+		}
+	}
+	return nil
+}
+
+// currentAuthorization returns the Authorization header the bot's requests are sent with.
+func (bot *botSession) currentAuthorization() string {
+	bot.mtx.Lock()
+	defer bot.mtx.Unlock()
+	return bot.authorization
+}
+
+// refreshToken re-reads the token of the bot after a request sent with the given Authorization header was rejected. It
+// returns the Authorization header to retry the request with, and false if the token hasn't changed.
+func (bot *botSession) refreshToken(ctx context.Context, authorization string) (string, bool) {
+	bot.mtx.Lock()
+	defer bot.mtx.Unlock()
+
+	// Another request already picked up the rotated token.
+	if bot.authorization != authorization {
+		return bot.authorization, true
+	}
+
+	token, err := bot.source(ctx)
+	if err != nil {
+		ctxzap.Extract(ctx).Error("error re-reading bot token", zap.String("bot", bot.name), zap.Error(err))
+		return "", false
+	}
+	if authorization == botAuthorization(token) {
+		return "", false
+	}
+
+	ctxzap.Extract(ctx).Info("bot token rotated", zap.String("bot", bot.name))
+	bot.authorization = botAuthorization(token)
+
+	// The gateway identifies with the new token when it reconnects. Open holds the session lock while it makes requests,
+	// which may be the one being refreshed, so the token is set once it is done.
+	go func() {
+		bot.session.Lock()
+		defer bot.session.Unlock()
+		bot.session.Identify.Token = bot.currentAuthorization()
+	}()
+	return bot.authorization, true
+}
+
+func botAuthorization(token string) string {
+	return fmt.Sprintf("Bot %s", token)
+}
+
+// tokenRefreshTransport sends requests with the current token of the bot that made them, and retries requests
+// rejected as unauthorized once, if the bot's token has been rotated since.
+type tokenRefreshTransport struct {
+	next http.RoundTripper
+	// sessions is set once the sessions have been opened.
+	sessions *sessions
+}
+
+func (t *tokenRefreshTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var bot *botSession
+	if t.sessions != nil {
+		bot = t.sessions.bot(req.Header.Get("Authorization"))
+	}
+	if bot == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	authorization := bot.currentAuthorization()
+	if authorization != bot.sentAuthorization {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	authorization, ok := bot.refreshToken(req.Context(), authorization)
+	if !ok {
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	retry.Header.Set("Authorization", authorization)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.next.RoundTrip(retry)
+}
@@ -2,6 +2,11 @@ package connector
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
@@ -20,10 +25,97 @@ var userResourceType = &v2.ResourceType{
 }
 
 type userBuilder struct {
-	conn *discordgo.Session
+	conn *sessions
+	*syncOptions
 }
 
-func newMemberResource(user *discordgo.Member, guild *discordgo.Guild) (*v2.Resource, error) {
+// guildMembers returns a page of the members of a guild along with the global display name of every member that has
+// one, from a single request. discordgo doesn't decode global display names.
+func guildMembers(s *discordgo.Session, guildID string, after string, limit int) ([]*discordgo.Member, map[string]string, error) {
+	v := url.Values{}
+	if after != "" {
+		v.Set("after", after)
+	}
+	v.Set("limit", strconv.Itoa(limit))
+
+	uri := discordgo.EndpointGuildMembers(guildID) + "?" + v.Encode()
+	body, err := s.RequestWithBucketID("GET", uri, nil, discordgo.EndpointGuildMembers(guildID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var members []*discordgo.Member
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, nil, err
+	}
+
+	var memberUsers []struct {
+		User struct {
+			ID         string `json:"id"`
+			GlobalName string `json:"global_name"`
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(body, &memberUsers); err != nil {
+		return nil, nil, err
+	}
+
+	globalNames := make(map[string]string)
+	for _, member := range memberUsers {
+		if member.User.GlobalName != "" {
+			globalNames[member.User.ID] = member.User.GlobalName
+		}
+	}
+	return members, globalNames, nil
+}
+
+// memberProfile returns the profile of a guild member. Times are formatted as RFC 3339 and omitted when unset, as is
+// the global display name.
+func memberProfile(member *discordgo.Member, globalName string) map[string]interface{} {
+	profile := map[string]interface{}{
+		"system":        member.User.System,
+		"discriminator": member.User.Discriminator,
+		"public_flags":  int64(member.User.PublicFlags),
+		"pending":       member.Pending,
+		"deaf":          member.Deaf,
+		"mute":          member.Mute,
+	}
+	if !member.JoinedAt.IsZero() {
+		profile["joined_at"] = member.JoinedAt.Format(time.RFC3339)
+	}
+	if member.PremiumSince != nil {
+		profile["premium_since"] = member.PremiumSince.Format(time.RFC3339)
+	}
+	if member.CommunicationDisabledUntil != nil {
+		profile["communication_disabled_until"] = member.CommunicationDisabledUntil.Format(time.RFC3339)
+	}
+	if globalName != "" {
+		profile["global_name"] = globalName
+	}
+	return profile
+}
+
+// withMemberStatus disables members that haven't passed membership screening or are timed out.
+func withMemberStatus(member *discordgo.Member, now time.Time) resource_sdk.UserTraitOption {
+	return func(ut *v2.UserTrait) error {
+		status := &v2.UserTrait_Status{Status: v2.UserTrait_Status_STATUS_ENABLED}
+		switch {
+		case member.Pending:
+			status = &v2.UserTrait_Status{
+				Status:  v2.UserTrait_Status_STATUS_DISABLED,
+				Details: "membership screening pending",
+			}
+		case member.CommunicationDisabledUntil != nil && member.CommunicationDisabledUntil.After(now):
+			status = &v2.UserTrait_Status{
+				Status:  v2.UserTrait_Status_STATUS_DISABLED,
+				Details: fmt.Sprintf("timed out until %s", member.CommunicationDisabledUntil.Format(time.RFC3339)),
+			}
+		}
+		ut.Status = status
+		return nil
+	}
+}
+
+func newMemberResource(user *discordgo.Member, guild *discordgo.Guild, globalName string) (*v2.Resource, error) {
 	guildResource, err := resource_sdk.NewResourceID(guildResourceType, guild.ID)
 	if err != nil {
 		return nil, err
@@ -35,6 +127,14 @@ func newMemberResource(user *discordgo.Member, guild *discordgo.Guild) (*v2.Reso
 	} else {
 		options = append(options, resource_sdk.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_HUMAN))
 	}
+	options = append(
+		options,
+		resource_sdk.WithUserProfile(memberProfile(user, globalName)),
+		withMemberStatus(user, time.Now()),
+	)
+	if icon := memberAvatarRef(user, guild.ID); icon != nil {
+		options = append(options, resource_sdk.WithUserIcon(icon))
+	}
 
 	name := user.Nick
 	if name == "" {
@@ -47,6 +147,7 @@ func newMemberResource(user *discordgo.Member, guild *discordgo.Guild) (*v2.Reso
 		user.User.ID,
 		options,
 		resource_sdk.WithParentResourceID(guildResource),
+		withExternalLink("users", user.User.ID),
 		resource_sdk.WithUserTrait(
 			resource_sdk.WithUserLogin(user.User.Username),
 		),
@@ -60,51 +161,59 @@ func (o *userBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 // List returns all the users from the database as resource objects.
 // Users include a UserTrait because they are the 'shape' of a standard user.
 func (o *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	resources, err := listGuildResources(ctx, o.syncOptions, o.conn, o.listGuild)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return resources, "", o.annotations(), nil
+}
+
+func (o *userBuilder) listGuild(baseGuild *discordgo.Guild) ([]*v2.Resource, error) {
 	resources := []*v2.Resource{}
 
-	for _, baseGuild := range o.conn.State.Guilds {
-		guild, err := o.conn.Guild(baseGuild.ID)
+	guild, err := o.conn.forGuild(baseGuild.ID).Guild(baseGuild.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	nextPageToken := ""
+	for {
+		members, globalNames, err := guildMembers(o.conn.forGuild(guild.ID), guild.ID, nextPageToken, 1000)
 		if err != nil {
-			return nil, "", nil, err
+			return nil, err
 		}
+		if len(members) == 0 {
+			break
+		}
+		for _, user := range members {
+			if !o.includesMember(user) {
+				continue
+			}
 
-		nextPageToken := ""
-		for {
-			members, err := o.conn.GuildMembers(guild.ID, nextPageToken, 1000)
+			resource, err := newMemberResource(user, guild, globalNames[user.User.ID])
 			if err != nil {
-				return nil, "", nil, err
-			}
-			if len(members) == 0 {
-				break
+				return nil, err
 			}
-			for _, user := range members {
-				resource, err := newMemberResource(user, guild)
-				if err != nil {
-					return nil, "", nil, err
-				}
 
-				resources = append(resources, resource)
-			}
-			nextPageToken = ""
-			if len(members) > 0 {
-				nextPageToken = members[len(members)-1].User.ID
-			}
+			resources = append(resources, resource)
 		}
+		nextPageToken = members[len(members)-1].User.ID
 	}
 
-	return resources, "", nil, nil
+	return resources, nil
 }
 
 // Entitlements always returns an empty slice for users.
 func (o *userBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
+	return nil, "", o.annotations(), nil
 }
 
 // Grants always returns an empty slice for users since they don't have any entitlements.
 func (o *userBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
+	return nil, "", o.annotations(), nil
 }
 
-func newUserBuilder(s *discordgo.Session) *userBuilder {
-	return &userBuilder{conn: s}
+func newUserBuilder(s *sessions, opts *syncOptions) *userBuilder {
+	return &userBuilder{conn: s, syncOptions: opts}
 }
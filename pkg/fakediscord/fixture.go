@@ -0,0 +1,142 @@
+package fakediscord
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Fixture is the data served by a Server. It is written in the same JSON format the Discord API uses.
+type Fixture struct {
+	// Bot is the user the connector's token belongs to.
+	Bot *discordgo.User `json:"bot"`
+	// Token is the token the bot must use. If it is empty, any token is accepted.
+	Token string `json:"token,omitempty"`
+	// Guilds are the guilds the bot is a member of, including their roles, channels, members, emojis and stickers.
+	Guilds []*discordgo.Guild `json:"guilds"`
+	// GlobalNames are the global display names of users, by user ID. discordgo doesn't decode them from the users in
+	// Guilds.
+	GlobalNames map[string]string `json:"global_names,omitempty"`
+	// Integrations are the raw integration objects of each guild, by guild ID.
+	Integrations map[string][]json.RawMessage `json:"integrations,omitempty"`
+	// ScheduledEvents are the scheduled events of each guild, by guild ID.
+	ScheduledEvents map[string][]*discordgo.GuildScheduledEvent `json:"scheduled_events,omitempty"`
+	// ScheduledEventUsers are the IDs of the users interested in each scheduled event, by event ID. Users who aren't
+	// members of the guild are served without a member object.
+	ScheduledEventUsers map[string][]string `json:"scheduled_event_users,omitempty"`
+	// Forbidden lists the IDs of guilds, channels and members the bot can't access. Requests for them fail with
+	// Missing Access.
+	Forbidden []string `json:"forbidden,omitempty"`
+}
+
+// LoadFixture reads a fixture from a JSON file.
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := &Fixture{}
+	if err := json.Unmarshal(data, fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+	fixture.normalize()
+	return fixture, nil
+}
+
+// normalize fills in the guild IDs that Discord sets on nested objects but that fixtures may leave out.
+func (f *Fixture) normalize() {
+	if f.Bot == nil {
+		f.Bot = &discordgo.User{ID: "1", Username: "baton", Bot: true}
+	}
+	for _, guild := range f.Guilds {
+		for _, channel := range guild.Channels {
+			channel.GuildID = guild.ID
+		}
+		for _, member := range guild.Members {
+			member.GuildID = guild.ID
+		}
+		for _, sticker := range guild.Stickers {
+			sticker.GuildID = guild.ID
+		}
+		if len(guild.Members) > 0 {
+			guild.MemberCount = len(guild.Members)
+		}
+		for _, event := range f.ScheduledEvents[guild.ID] {
+			event.GuildID = guild.ID
+			event.UserCount = len(f.ScheduledEventUsers[event.ID])
+		}
+	}
+}
+
+func (f *Fixture) guild(id string) *discordgo.Guild {
+	for _, guild := range f.Guilds {
+		if guild.ID == id {
+			return guild
+		}
+	}
+	return nil
+}
+
+func (f *Fixture) channel(id string) *discordgo.Channel {
+	for _, guild := range f.Guilds {
+		for _, channel := range guild.Channels {
+			if channel.ID == id {
+				return channel
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Fixture) scheduledEvent(guildID, id string) *discordgo.GuildScheduledEvent {
+	for _, event := range f.ScheduledEvents[guildID] {
+		if event.ID == id {
+			return event
+		}
+	}
+	return nil
+}
+
+func (f *Fixture) member(guild *discordgo.Guild, userID string) *discordgo.Member {
+	for _, member := range guild.Members {
+		if member.User.ID == userID {
+			return member
+		}
+	}
+	return nil
+}
+
+func (f *Fixture) role(guild *discordgo.Guild, roleID string) *discordgo.Role {
+	for _, role := range guild.Roles {
+		if role.ID == roleID {
+			return role
+		}
+	}
+	return nil
+}
+
+func (f *Fixture) user(id string) *discordgo.User {
+	if id == "@me" || id == f.Bot.ID {
+		return f.Bot
+	}
+	for _, guild := range f.Guilds {
+		for _, member := range guild.Members {
+			if member.User.ID == id {
+				return member.User
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Fixture) forbidden(id string) bool {
+	for _, forbidden := range f.Forbidden {
+		if forbidden == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package fakediscord
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gorilla/websocket"
+)
+
+// heartbeatInterval is sent in the Hello event. It's long enough that a sync never has to wait on a heartbeat.
+const heartbeatInterval = 41250
+
+const (
+	opDispatch     = 0
+	opHeartbeat    = 1
+	opIdentify     = 2
+	opHello        = 10
+	opHeartbeatAck = 11
+)
+
+type gatewayPayload struct {
+	Op       int         `json:"op"`
+	Data     interface{} `json:"d"`
+	Sequence int64       `json:"s,omitempty"`
+	Type     string      `json:"t,omitempty"`
+}
+
+var upgrader = websocket.Upgrader{}
+
+// serveGateway implements just enough of the gateway for a session to open: Hello, Identify, Ready and heartbeats.
+// As on Discord, Ready carries the guilds as unavailable, with nothing but their IDs, and a Guild Create event follows
+// for each of them.
+func (s *Server) serveGateway(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	err = conn.WriteJSON(gatewayPayload{
+		Op:   opHello,
+		Data: map[string]interface{}{"heartbeat_interval": heartbeatInterval},
+	})
+	if err != nil {
+		return
+	}
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var payload struct {
+			Op int `json:"op"`
+		}
+		if err := json.Unmarshal(message, &payload); err != nil {
+			return
+		}
+
+		switch payload.Op {
+		case opIdentify:
+			err = s.writeReady(conn)
+		case opHeartbeat:
+			err = conn.WriteJSON(gatewayPayload{Op: opHeartbeatAck})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeReady sends Ready and then a Guild Create event for every guild.
+func (s *Server) writeReady(conn *websocket.Conn) error {
+	unavailable := make([]*discordgo.Guild, 0, len(s.fixture.Guilds))
+	for _, guild := range s.fixture.Guilds {
+		unavailable = append(unavailable, &discordgo.Guild{ID: guild.ID, Unavailable: true})
+	}
+	err := conn.WriteJSON(gatewayPayload{
+		Op:       opDispatch,
+		Sequence: 1,
+		Type:     "READY",
+		Data: &discordgo.Ready{
+			Version:   9,
+			SessionID: "fakediscord",
+			User:      s.fixture.Bot,
+			Guilds:    unavailable,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, guild := range s.fixture.Guilds {
+		g := restGuild(guild)
+		g.Channels = guild.Channels
+		err := conn.WriteJSON(gatewayPayload{
+			Op:       opDispatch,
+			Sequence: int64(i + 2),
+			Type:     "GUILD_CREATE",
+			Data:     g,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
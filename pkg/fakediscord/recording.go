@@ -0,0 +1,256 @@
+package fakediscord
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Interaction is a recorded API request and the response to it.
+type Interaction struct {
+	Method string `json:"method"`
+	// Path is the path of the request below the versioned API prefix, e.g. "guilds/1/members".
+	Path   string            `json:"path"`
+	Query  string            `json:"query,omitempty"`
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   json.RawMessage   `json:"body,omitempty"`
+}
+
+// Recording is a sequence of API interactions, in the order they happened.
+type Recording struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// LoadRecording reads a recording from a JSON file, either written by Save or appended to by a Recorder.
+func LoadRecording(path string) (*Recording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	recording := &Recording{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		// Each value is either a whole recording or, as a Recorder writes them, a single interaction.
+		var value struct {
+			Interaction
+			Interactions []*Interaction `json:"interactions"`
+		}
+		if err := dec.Decode(&value); err != nil {
+			return nil, fmt.Errorf("invalid recording %s: %w", path, err)
+		}
+		if value.Interactions != nil {
+			recording.Interactions = append(recording.Interactions, value.Interactions...)
+		} else {
+			interaction := value.Interaction
+			recording.Interactions = append(recording.Interactions, &interaction)
+		}
+	}
+	return recording, nil
+}
+
+// Save writes the recording to a JSON file.
+func (r *Recording) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// recordedHeaders are the response headers kept in a recording. Everything else, including cookies, is dropped.
+var recordedHeaders = []string{
+	"Content-Type",
+	"Retry-After",
+	"X-RateLimit-Limit",
+	"X-RateLimit-Remaining",
+	"X-RateLimit-Reset-After",
+	"X-RateLimit-Bucket",
+	"X-RateLimit-Global",
+	"X-RateLimit-Scope",
+}
+
+// Recorder is an http.RoundTripper that records the Discord API responses passing through it to a file, with
+// credentials and personal information redacted. Request headers, and so the bot token, are never recorded. Every
+// response is appended to the file as it arrives, so it is complete whenever the process exits. LoadRecording reads it.
+type Recorder struct {
+	next http.RoundTripper
+	path string
+
+	// file is created, replacing any earlier recording, when the first response is recorded.
+	mtx  sync.Mutex
+	file *os.File
+}
+
+// NewRecorder returns a Recorder that sends requests on to next and records them to the file at path.
+func NewRecorder(next http.RoundTripper, path string) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{next: next, path: path}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	apiPath, ok := apiPath(req.URL.Path)
+	if !ok {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := &Interaction{
+		Method: req.Method,
+		Path:   apiPath,
+		Query:  req.URL.RawQuery,
+		Status: resp.StatusCode,
+		Header: make(map[string]string),
+	}
+	for _, header := range recordedHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			interaction.Header[header] = value
+		}
+	}
+	if len(body) > 0 {
+		interaction.Body, err = redactBody(body)
+		if err != nil {
+			return nil, fmt.Errorf("error redacting response to %s %s: %w", req.Method, apiPath, err)
+		}
+	}
+
+	if err := r.append(interaction); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (r *Recorder) append(interaction *Interaction) error {
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.file == nil {
+		if r.file, err = os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600); err != nil {
+			return err
+		}
+	}
+	_, err = r.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the recording file. Responses recorded afterwards start a new recording.
+func (r *Recorder) Close() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// apiPath returns the path below the versioned API prefix, and whether the path is an API path at all.
+func apiPath(urlPath string) (string, bool) {
+	_, path, ok := strings.Cut(urlPath, "/api/v"+discordgo.APIVersion+"/")
+	if !ok {
+		return "", false
+	}
+	return strings.Trim(path, "/"), true
+}
+
+// redactedKeys are JSON fields holding credentials or contact details. Their values are removed.
+var redactedKeys = map[string]bool{
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"email":         true,
+	"phone":         true,
+}
+
+// pseudonymizedKeys are JSON fields holding names and images of people. Their values are replaced with a hash of the
+// value, so that the same name is replaced the same way across responses and the recording stays consistent.
+var pseudonymizedKeys = map[string]bool{
+	"username":    true,
+	"global_name": true,
+	"nick":        true,
+	"bio":         true,
+	"avatar":      true,
+	"banner":      true,
+}
+
+func redactBody(body []byte) (json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		// Not JSON, so there's nothing that can be redacted selectively.
+		return json.Marshal("[redacted]")
+	}
+	return json.Marshal(redactValue(value))
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			s, isString := field.(string)
+			switch {
+			case redactedKeys[key] && field != nil:
+				v[key] = "[redacted]"
+			case pseudonymizedKeys[key] && isString && s != "":
+				v[key] = pseudonym(key, s)
+			default:
+				v[key] = redactValue(field)
+			}
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// pseudonym returns a stable replacement for the value. Image hashes stay hex strings of the same length, so that
+// asset references built from them still have the expected shape.
+func pseudonym(key string, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	hash := hex.EncodeToString(sum[:])
+	switch key {
+	case "avatar", "banner":
+		prefix := ""
+		if strings.HasPrefix(value, "a_") {
+			prefix = "a_"
+		}
+		return prefix + hash[:32]
+	default:
+		return key + "-" + hash[:8]
+	}
+}
@@ -0,0 +1,187 @@
+package fakediscord_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+
+	"github.com/ConductorOne/baton-discord/pkg/connector"
+	"github.com/ConductorOne/baton-discord/pkg/fakediscord"
+	"github.com/ConductorOne/baton-discord/pkg/golden"
+)
+
+var update = flag.Bool("update", false, "Record testdata/recorded.json again, and overwrite its golden file.")
+
+const (
+	recordedPath       = "testdata/recorded.json"
+	recordedGoldenPath = "testdata/recorded.golden.json"
+
+	botToken    = "fixture-bot-token"
+	aliceAvatar = "a_0123456789abcdef0123456789abcdef"
+	aliceName   = "Alice Liddell"
+	bobEmail    = "bob@example.com"
+)
+
+func testContext() context.Context {
+	return ctxzap.ToContext(context.Background(), zap.NewNop())
+}
+
+// personalFixture is the basic fixture with the kind of personal information a real server has, which recordings must
+// not contain.
+func personalFixture(t *testing.T) *fakediscord.Fixture {
+	t.Helper()
+	fixture, err := fakediscord.LoadFixture("testdata/basic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture.Token = botToken
+
+	members := fixture.Guilds[0].Members
+	members[0].User.Avatar = aliceAvatar
+	members[0].Nick = aliceName
+	members[1].User.Email = bobEmail
+	return fixture
+}
+
+// syncAndCheck syncs everything through a connector talking to baseURL, and compares it with the golden file.
+func syncAndCheck(t *testing.T, baseURL, token, goldenPath string) {
+	t.Helper()
+	cb, err := connector.New(testContext(), token, connector.WithBaseURL(baseURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := connectorbuilder.NewConnector(testContext(), cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := golden.Sync(testContext(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := golden.Check(snapshot, goldenPath, *update); err != nil {
+		t.Error(err)
+	}
+}
+
+// record syncs the personal fixture with every response recorded to path.
+func record(t *testing.T, path string) {
+	t.Helper()
+	server := fakediscord.NewServer(personalFixture(t))
+	defer server.Close()
+
+	var recorder *fakediscord.Recorder
+	defer func() {
+		if recorder != nil {
+			if err := recorder.Close(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	cb, err := connector.New(
+		testContext(),
+		botToken,
+		connector.WithBaseURL(server.URL),
+		connector.WithTransport(func(next http.RoundTripper) http.RoundTripper {
+			recorder = fakediscord.NewRecorder(next, path)
+			return recorder
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := connectorbuilder.NewConnector(testContext(), cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := golden.Sync(testContext(), c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkRedacted fails if the recording contains any of the credentials or personal information of the fixture.
+func checkRedacted(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recording := string(data)
+
+	for _, secret := range []string{botToken, aliceAvatar, aliceName, bobEmail, `"alice"`, `"bob"`, `"Bobby"`} {
+		if strings.Contains(recording, secret) {
+			t.Errorf("%s contains %s", path, secret)
+		}
+	}
+
+	// Names are replaced the same way in every response, so that the users in a recording stay recognizable.
+	sum := sha256.Sum256([]byte("alice"))
+	if pseudonym := `"username": "username-` + hex.EncodeToString(sum[:])[:8] + `"`; strings.Count(recording, pseudonym) < 2 {
+		t.Errorf("%s doesn't pseudonymize alice as %s in every response", path, pseudonym)
+	}
+
+	// Avatars stay image hashes, so asset refs can still be built from them.
+	avatars := regexp.MustCompile(`"avatar":\s*"(a_[0-9a-f]{32})"`).FindAllStringSubmatch(recording, -1)
+	if len(avatars) == 0 {
+		t.Errorf("%s has no pseudonymized animated avatar", path)
+	}
+	for _, avatar := range avatars {
+		if avatar[1] != avatars[0][1] {
+			t.Errorf("%s has avatar %s pseudonymized as both %s and %s", path, aliceAvatar, avatars[0][1], avatar[1])
+		}
+	}
+}
+
+func TestRecorderRedacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.json")
+	record(t, path)
+	checkRedacted(t, path)
+
+	recording, err := fakediscord.LoadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, interaction := range recording.Interactions {
+		for header := range interaction.Header {
+			if strings.EqualFold(header, "Authorization") || strings.EqualFold(header, "Set-Cookie") {
+				t.Errorf("%s %s recorded the %s header", interaction.Method, interaction.Path, header)
+			}
+		}
+	}
+}
+
+// TestReplayRecording syncs the checked in recording, which must stay redacted, and compares it with its golden file.
+// Run it with -update to record the fixture again.
+func TestReplayRecording(t *testing.T) {
+	if *update {
+		if err := os.Remove(recordedPath); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		record(t, recordedPath)
+	}
+	checkRedacted(t, recordedPath)
+
+	recording, err := fakediscord.LoadRecording(recordedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := fakediscord.NewReplayServer(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// Nothing is sent to Discord, so any token will do.
+	syncAndCheck(t, server.URL, "replay", recordedGoldenPath)
+}
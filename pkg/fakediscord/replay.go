@@ -0,0 +1,102 @@
+package fakediscord
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// replayer answers requests from a recording.
+type replayer struct {
+	mtx          sync.Mutex
+	interactions map[string][]*Interaction
+	served       map[string]int
+}
+
+func interactionKey(method, path, query string) string {
+	return method + " " + path + "?" + query
+}
+
+// newReplayer returns a replayer for the recording, and a fixture with the bot and guilds found in it for the
+// gateway to serve.
+func newReplayer(recording *Recording) (*replayer, *Fixture, error) {
+	r := &replayer{
+		interactions: make(map[string][]*Interaction),
+		served:       make(map[string]int),
+	}
+	fixture := &Fixture{}
+	guilds := make(map[string]*discordgo.Guild)
+
+	for _, interaction := range recording.Interactions {
+		key := interactionKey(interaction.Method, interaction.Path, interaction.Query)
+		r.interactions[key] = append(r.interactions[key], interaction)
+
+		if interaction.Method != http.MethodGet || interaction.Status != http.StatusOK {
+			continue
+		}
+		parts := strings.Split(interaction.Path, "/")
+		switch {
+		case interaction.Path == "users/@me" && fixture.Bot == nil:
+			fixture.Bot = &discordgo.User{}
+			if err := json.Unmarshal(interaction.Body, fixture.Bot); err != nil {
+				return nil, nil, fmt.Errorf("invalid recorded response to %s: %w", interaction.Path, err)
+			}
+		case parts[0] == "guilds" && len(parts) == 2 && guilds[parts[1]] == nil:
+			guild := &discordgo.Guild{}
+			if err := json.Unmarshal(interaction.Body, guild); err != nil {
+				return nil, nil, fmt.Errorf("invalid recorded response to %s: %w", interaction.Path, err)
+			}
+			guilds[guild.ID] = guild
+			fixture.Guilds = append(fixture.Guilds, guild)
+		}
+	}
+
+	// Channels are only attached once every guild is known, since they may have been requested first.
+	for _, interaction := range recording.Interactions {
+		parts := strings.Split(interaction.Path, "/")
+		if interaction.Method != http.MethodGet || interaction.Status != http.StatusOK ||
+			len(parts) != 3 || parts[0] != "guilds" || parts[2] != "channels" {
+			continue
+		}
+		guild := guilds[parts[1]]
+		if guild == nil || guild.Channels != nil {
+			continue
+		}
+		if err := json.Unmarshal(interaction.Body, &guild.Channels); err != nil {
+			return nil, nil, fmt.Errorf("invalid recorded response to %s: %w", interaction.Path, err)
+		}
+	}
+
+	fixture.normalize()
+	return r, fixture, nil
+}
+
+func (r *replayer) serve(w http.ResponseWriter, method, path, query string) {
+	key := interactionKey(method, path, query)
+
+	r.mtx.Lock()
+	interactions := r.interactions[key]
+	i := r.served[key]
+	if i < len(interactions)-1 {
+		r.served[key] = i + 1
+	}
+	r.mtx.Unlock()
+
+	if len(interactions) == 0 {
+		writeJSON(w, http.StatusNotFound, &apiError{
+			Message: fmt.Sprintf("no recorded response to %s", key),
+		})
+		return
+	}
+
+	interaction := interactions[i]
+	for header, value := range interaction.Header {
+		w.Header().Set(header, value)
+	}
+	w.WriteHeader(interaction.Status)
+	_, _ = w.Write(interaction.Body)
+}
@@ -0,0 +1,440 @@
+// Package fakediscord is an in-process imitation of the Discord REST API and gateway that serves a fixture, so the
+// connector can be run end to end without a bot token or network access:
+//
+//	server := fakediscord.NewServer(fixture)
+//	defer server.Close()
+//	c, err := connector.New(ctx, "token", connector.WithBaseURL(server.URL))
+//
+// Only the parts of the API the connector uses are implemented. NewReplayServer serves a Recording made by a Recorder
+// instead, to reproduce a sync against a real server.
+package fakediscord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/ConductorOne/baton-discord/pkg/snowflake"
+)
+
+// Server serves a fixture over HTTP.
+type Server struct {
+	// URL is the base URL of the server, to be passed to connector.WithBaseURL.
+	URL string
+
+	fixture *Fixture
+	replay  *replayer
+	srv     *httptest.Server
+
+	tokenMtx sync.RWMutex
+	token    string
+
+	mtx sync.Mutex
+}
+
+// NewServer starts a server for the fixture. It should be closed when no longer needed.
+func NewServer(fixture *Fixture) *Server {
+	fixture.normalize()
+
+	s := &Server{fixture: fixture, token: fixture.Token}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.route))
+	s.URL = s.srv.URL
+	return s
+}
+
+// NewReplayServer starts a server that answers every request with the response recorded for it. Requests that were
+// recorded more than once are answered with the recorded responses in order, repeating the last one. The gateway
+// serves the guilds found in the recording.
+func NewReplayServer(recording *Recording) (*Server, error) {
+	replay, fixture, err := newReplayer(recording)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{fixture: fixture, replay: replay}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.route))
+	s.URL = s.srv.URL
+	return s, nil
+}
+
+// RotateToken changes the token the bot must use, rejecting the previous one.
+func (s *Server) RotateToken(token string) {
+	s.tokenMtx.Lock()
+	defer s.tokenMtx.Unlock()
+	s.token = token
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	s.tokenMtx.RLock()
+	defer s.tokenMtx.RUnlock()
+	return s.token == "" || r.Header.Get("Authorization") == "Bot "+s.token
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// apiError is the body of an error response from the Discord API.
+type apiError struct {
+	status  int
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+var (
+	errUnknownGuild   = &apiError{http.StatusNotFound, discordgo.ErrCodeUnknownGuild, "Unknown Guild"}
+	errUnknownChannel = &apiError{http.StatusNotFound, discordgo.ErrCodeUnknownChannel, "Unknown Channel"}
+	errUnknownMember  = &apiError{http.StatusNotFound, discordgo.ErrCodeUnknownMember, "Unknown Member"}
+	errUnknownUser    = &apiError{http.StatusNotFound, discordgo.ErrCodeUnknownUser, "Unknown User"}
+	errUnknownEvent   = &apiError{http.StatusNotFound, discordgo.ErrCodeUnknownGuildScheduledEvent, "Unknown Guild Scheduled Event"}
+	errUnknownEmoji   = &apiError{http.StatusNotFound, discordgo.ErrCodeUnknownEmoji, "Unknown Emoji"}
+	errUnknownRole    = &apiError{http.StatusNotFound, discordgo.ErrCodeUnknownRole, "Unknown Role"}
+	errInvalidBody    = &apiError{http.StatusBadRequest, discordgo.ErrCodeInvalidFormBody, "Invalid Form Body"}
+	errMissingAccess  = &apiError{http.StatusForbidden, discordgo.ErrCodeMissingAccess, "Missing Access"}
+	errNotFound       = &apiError{http.StatusNotFound, 0, "404: Not Found"}
+	errUnauthorized   = &apiError{http.StatusUnauthorized, 0, "401: Unauthorized"}
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err *apiError) {
+	writeJSON(w, err.status, err)
+}
+
+// route dispatches a request by the path below the versioned API prefix, e.g. "guilds/1/members".
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	if strings.TrimSuffix(r.URL.Path, "/") == "/gateway" {
+		s.serveGateway(w, r)
+		return
+	}
+
+	path, ok := apiPath(r.URL.Path)
+	if !ok {
+		writeError(w, errNotFound)
+		return
+	}
+	parts := strings.Split(path, "/")
+
+	if !s.authorized(r) {
+		writeError(w, errUnauthorized)
+		return
+	}
+
+	if parts[0] != "gateway" && s.replay != nil {
+		s.replay.serve(w, r.Method, path, r.URL.RawQuery)
+		return
+	}
+	// Provisioning changes the fixture, so requests are served one at a time.
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if r.Method != http.MethodGet {
+		s.serveChange(w, r, parts)
+		return
+	}
+
+	switch {
+	case parts[0] == "gateway":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"url":    "ws" + strings.TrimPrefix(s.URL, "http") + "/gateway",
+			"shards": 1,
+		})
+	case parts[0] == "users" && len(parts) == 2:
+		s.serveUser(w, parts[1])
+	case parts[0] == "guilds" && len(parts) >= 2:
+		s.serveGuild(w, r, parts[1], parts[2:])
+	case parts[0] == "channels" && len(parts) == 2:
+		s.serveChannel(w, parts[1])
+	default:
+		writeError(w, errNotFound)
+	}
+}
+
+// serveChange serves the requests that change a guild: adding and removing role members, and setting and deleting
+// channel permission overwrites.
+func (s *Server) serveChange(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 6 && parts[0] == "guilds" && parts[2] == "members" && parts[4] == "roles":
+		guild := s.fixture.guild(parts[1])
+		if guild == nil || s.fixture.forbidden(guild.ID) {
+			writeError(w, errUnknownGuild)
+			return
+		}
+		member := s.fixture.member(guild, parts[3])
+		if member == nil {
+			writeError(w, errUnknownMember)
+			return
+		}
+		if s.fixture.role(guild, parts[5]) == nil {
+			writeError(w, errUnknownRole)
+			return
+		}
+
+		roles := []string{}
+		for _, roleID := range member.Roles {
+			if roleID != parts[5] {
+				roles = append(roles, roleID)
+			}
+		}
+		switch r.Method {
+		case http.MethodPut:
+			member.Roles = append(roles, parts[5])
+		case http.MethodDelete:
+			member.Roles = roles
+		default:
+			writeError(w, errNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 4 && parts[0] == "channels" && parts[2] == "permissions":
+		channel := s.fixture.channel(parts[1])
+		if channel == nil || s.fixture.forbidden(channel.ID) {
+			writeError(w, errUnknownChannel)
+			return
+		}
+
+		overwrites := []*discordgo.PermissionOverwrite{}
+		for _, overwrite := range channel.PermissionOverwrites {
+			if overwrite.ID != parts[3] {
+				overwrites = append(overwrites, overwrite)
+			}
+		}
+		switch r.Method {
+		case http.MethodPut:
+			overwrite := &discordgo.PermissionOverwrite{}
+			if err := json.NewDecoder(r.Body).Decode(overwrite); err != nil {
+				writeError(w, errInvalidBody)
+				return
+			}
+			overwrite.ID = parts[3]
+			channel.PermissionOverwrites = append(overwrites, overwrite)
+		case http.MethodDelete:
+			channel.PermissionOverwrites = overwrites
+		default:
+			writeError(w, errNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, errNotFound)
+	}
+}
+
+func (s *Server) serveUser(w http.ResponseWriter, id string) {
+	user := s.fixture.user(id)
+	if user == nil {
+		writeError(w, errUnknownUser)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (s *Server) serveChannel(w http.ResponseWriter, id string) {
+	if s.fixture.forbidden(id) {
+		writeError(w, errMissingAccess)
+		return
+	}
+	channel := s.fixture.channel(id)
+	if channel == nil {
+		writeError(w, errUnknownChannel)
+		return
+	}
+	writeJSON(w, http.StatusOK, channel)
+}
+
+func (s *Server) serveGuild(w http.ResponseWriter, r *http.Request, id string, sub []string) {
+	if s.fixture.forbidden(id) {
+		writeError(w, errMissingAccess)
+		return
+	}
+	guild := s.fixture.guild(id)
+	if guild == nil {
+		writeError(w, errUnknownGuild)
+		return
+	}
+
+	switch {
+	case len(sub) == 0:
+		writeJSON(w, http.StatusOK, restGuild(guild))
+	case len(sub) == 1 && sub[0] == "roles":
+		writeJSON(w, http.StatusOK, guild.Roles)
+	case len(sub) == 1 && sub[0] == "channels":
+		channels := []*discordgo.Channel{}
+		for _, channel := range guild.Channels {
+			if !s.fixture.forbidden(channel.ID) {
+				channels = append(channels, channel)
+			}
+		}
+		writeJSON(w, http.StatusOK, channels)
+	case len(sub) == 1 && sub[0] == "members":
+		s.serveMembers(w, r, guild)
+	case len(sub) == 2 && sub[0] == "members":
+		member := s.fixture.member(guild, sub[1])
+		if member == nil {
+			writeError(w, errUnknownMember)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.servedMember(member))
+	case len(sub) == 1 && sub[0] == "integrations":
+		integrations := s.fixture.Integrations[guild.ID]
+		if integrations == nil {
+			integrations = []json.RawMessage{}
+		}
+		writeJSON(w, http.StatusOK, integrations)
+	case len(sub) == 1 && sub[0] == "emojis":
+		emojis := guild.Emojis
+		if emojis == nil {
+			emojis = []*discordgo.Emoji{}
+		}
+		writeJSON(w, http.StatusOK, emojis)
+	case len(sub) == 2 && sub[0] == "emojis":
+		for _, emoji := range guild.Emojis {
+			if emoji.ID == sub[1] {
+				writeJSON(w, http.StatusOK, emoji)
+				return
+			}
+		}
+		writeError(w, errUnknownEmoji)
+	case len(sub) == 1 && sub[0] == "stickers":
+		stickers := guild.Stickers
+		if stickers == nil {
+			stickers = []*discordgo.Sticker{}
+		}
+		writeJSON(w, http.StatusOK, stickers)
+	case len(sub) == 1 && sub[0] == "scheduled-events":
+		events := s.fixture.ScheduledEvents[guild.ID]
+		if events == nil {
+			events = []*discordgo.GuildScheduledEvent{}
+		}
+		writeJSON(w, http.StatusOK, events)
+	case len(sub) == 2 && sub[0] == "scheduled-events":
+		event := s.fixture.scheduledEvent(guild.ID, sub[1])
+		if event == nil {
+			writeError(w, errUnknownEvent)
+			return
+		}
+		writeJSON(w, http.StatusOK, event)
+	case len(sub) == 3 && sub[0] == "scheduled-events" && sub[2] == "users":
+		if s.fixture.scheduledEvent(guild.ID, sub[1]) == nil {
+			writeError(w, errUnknownEvent)
+			return
+		}
+		s.serveScheduledEventUsers(w, r, guild, sub[1])
+	default:
+		writeError(w, errNotFound)
+	}
+}
+
+// serveScheduledEventUsers pages through the users interested in an event ordered by user ID, as Discord does.
+func (s *Server) serveScheduledEventUsers(w http.ResponseWriter, r *http.Request, guild *discordgo.Guild, eventID string) {
+	userIDs := append([]string{}, s.fixture.ScheduledEventUsers[eventID]...)
+	sort.Slice(userIDs, func(i, j int) bool {
+		return snowflake.Less(userIDs[i], userIDs[j])
+	})
+
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	after := r.URL.Query().Get("after")
+	withMember := r.URL.Query().Get("with_member") == "true"
+
+	page := []*discordgo.GuildScheduledEventUser{}
+	for _, userID := range userIDs {
+		if after != "" && !snowflake.Less(after, userID) {
+			continue
+		}
+		if len(page) == limit {
+			break
+		}
+
+		user := s.fixture.user(userID)
+		if user == nil {
+			user = &discordgo.User{ID: userID}
+		}
+		eventUser := &discordgo.GuildScheduledEventUser{GuildScheduledEventID: eventID, User: user}
+		if withMember {
+			eventUser.Member = s.fixture.member(guild, userID)
+		}
+		page = append(page, eventUser)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// serveMembers pages through the members of a guild ordered by user ID, as Discord does.
+func (s *Server) serveMembers(w http.ResponseWriter, r *http.Request, guild *discordgo.Guild) {
+	members := append([]*discordgo.Member{}, guild.Members...)
+	sort.Slice(members, func(i, j int) bool {
+		return snowflake.Less(members[i].User.ID, members[j].User.ID)
+	})
+
+	limit := 1
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	after := r.URL.Query().Get("after")
+
+	page := []servedMember{}
+	for _, member := range members {
+		if after != "" && !snowflake.Less(after, member.User.ID) {
+			continue
+		}
+		if len(page) == limit {
+			break
+		}
+		page = append(page, s.servedMember(member))
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) servedMember(member *discordgo.Member) servedMember {
+	return servedMember{Member: member, globalName: s.fixture.GlobalNames[member.User.ID]}
+}
+
+// servedMember is a member as the REST API serves it, with the user's global display name that discordgo doesn't encode.
+type servedMember struct {
+	*discordgo.Member
+	globalName string
+}
+
+func (m servedMember) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(m.Member)
+	if err != nil || m.globalName == "" {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	var user map[string]interface{}
+	if err := json.Unmarshal(fields["user"], &user); err != nil {
+		return nil, err
+	}
+	user["global_name"] = m.globalName
+	if fields["user"], err = json.Marshal(user); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// restGuild returns the guild as the REST API does, without the members and channels only sent over the gateway.
+func restGuild(guild *discordgo.Guild) *discordgo.Guild {
+	g := *guild
+	g.Members = nil
+	g.Channels = nil
+	g.Presences = nil
+	g.VoiceStates = nil
+	return &g
+}
@@ -0,0 +1,297 @@
+// Package golden snapshots everything a connector syncs into a canonical JSON document, and compares it with a golden
+// file. Resource, entitlement and grant IDs must never change silently, so a difference in the set of IDs is reported
+// separately from other changes.
+package golden
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/types"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Snapshot is everything synced from a connector, each list ordered by ID.
+type Snapshot struct {
+	ResourceTypes []json.RawMessage `json:"resource_types"`
+	Resources     []json.RawMessage `json:"resources"`
+	Entitlements  []json.RawMessage `json:"entitlements"`
+	Grants        []json.RawMessage `json:"grants"`
+}
+
+// Sync lists every resource type, resource, entitlement and grant of the connector.
+func Sync(ctx context.Context, c types.ConnectorServer) (*Snapshot, error) {
+	var (
+		resourceTypes []*v2.ResourceType
+		resources     []*v2.Resource
+		entitlements  []*v2.Entitlement
+		grants        []*v2.Grant
+	)
+
+	err := paginate(func(token string) (string, error) {
+		resp, err := c.ListResourceTypes(ctx, &v2.ResourceTypesServiceListResourceTypesRequest{PageToken: token})
+		if err != nil {
+			return "", err
+		}
+		resourceTypes = append(resourceTypes, resp.List...)
+		return resp.NextPageToken, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing resource types: %w", err)
+	}
+
+	for _, resourceType := range resourceTypes {
+		err := paginate(func(token string) (string, error) {
+			resp, err := c.ListResources(ctx, &v2.ResourcesServiceListResourcesRequest{
+				ResourceTypeId: resourceType.Id,
+				PageToken:      token,
+			})
+			if err != nil {
+				return "", err
+			}
+			resources = append(resources, resp.List...)
+			return resp.NextPageToken, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s resources: %w", resourceType.Id, err)
+		}
+	}
+
+	for _, resource := range resources {
+		err := paginate(func(token string) (string, error) {
+			resp, err := c.ListEntitlements(ctx, &v2.EntitlementsServiceListEntitlementsRequest{
+				Resource:  resource,
+				PageToken: token,
+			})
+			if err != nil {
+				return "", err
+			}
+			entitlements = append(entitlements, resp.List...)
+			return resp.NextPageToken, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing entitlements of %s %s: %w", resource.Id.ResourceType, resource.Id.Resource, err)
+		}
+
+		err = paginate(func(token string) (string, error) {
+			resp, err := c.ListGrants(ctx, &v2.GrantsServiceListGrantsRequest{
+				Resource:  resource,
+				PageToken: token,
+			})
+			if err != nil {
+				return "", err
+			}
+			for _, grant := range resp.List {
+				grants = append(grants, referenceOnly(grant))
+			}
+			return resp.NextPageToken, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing grants of %s %s: %w", resource.Id.ResourceType, resource.Id.Resource, err)
+		}
+	}
+
+	snapshot := &Snapshot{}
+	if snapshot.ResourceTypes, err = canonicalList(resourceTypes, func(r *v2.ResourceType) string { return r.Id }); err != nil {
+		return nil, err
+	}
+	if snapshot.Resources, err = canonicalList(resources, resourceKey); err != nil {
+		return nil, err
+	}
+	if snapshot.Entitlements, err = canonicalList(entitlements, func(e *v2.Entitlement) string { return e.Id }); err != nil {
+		return nil, err
+	}
+	if snapshot.Grants, err = canonicalList(grants, func(g *v2.Grant) string { return g.Id }); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// referenceOnly returns the grant with its entitlement and principal reduced to their IDs, since they are snapshotted
+// in full on their own.
+func referenceOnly(grant *v2.Grant) *v2.Grant {
+	g := proto.Clone(grant).(*v2.Grant)
+	if g.Entitlement != nil {
+		g.Entitlement = &v2.Entitlement{Id: g.Entitlement.Id}
+	}
+	if g.Principal != nil {
+		g.Principal = &v2.Resource{Id: g.Principal.Id}
+	}
+	return g
+}
+
+func paginate(page func(token string) (string, error)) error {
+	token := ""
+	for {
+		next, err := page(token)
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		if next == token {
+			return fmt.Errorf("page token %q was returned twice", next)
+		}
+		token = next
+	}
+}
+
+func resourceKey(r *v2.Resource) string {
+	return r.Id.ResourceType + ":" + r.Id.Resource
+}
+
+// canonicalList returns the messages as canonical JSON, ordered by key. Duplicate keys are an error, since they mean
+// two objects were given the same ID.
+func canonicalList[T proto.Message](messages []T, key func(T) string) ([]json.RawMessage, error) {
+	sort.SliceStable(messages, func(i, j int) bool {
+		return key(messages[i]) < key(messages[j])
+	})
+
+	list := make([]json.RawMessage, 0, len(messages))
+	for i, message := range messages {
+		if i > 0 && key(messages[i-1]) == key(message) {
+			return nil, fmt.Errorf("duplicate id %q", key(message))
+		}
+
+		data, err := canonicalJSON(message)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, data)
+	}
+	return list, nil
+}
+
+// canonicalJSON marshals the message with its fields in a stable order. protojson deliberately randomizes whitespace,
+// so its output is decoded and encoded again with encoding/json, which sorts object keys.
+func canonicalJSON(message proto.Message) (json.RawMessage, error) {
+	data, err := protojson.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// Marshal returns the snapshot as an indented JSON document.
+func (s *Snapshot) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ErrMismatch is returned by Check when the snapshot doesn't match the golden file.
+var ErrMismatch = errors.New("snapshot doesn't match the golden file")
+
+// Check compares the snapshot with the golden file at path, or overwrites the file with the snapshot if update is
+// set.
+func Check(snapshot *Snapshot, path string, update bool) error {
+	got, err := snapshot.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if update {
+		return os.WriteFile(path, got, 0o600)
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(got, want) {
+		return nil
+	}
+
+	golden := &Snapshot{}
+	if err := json.Unmarshal(want, golden); err != nil {
+		return fmt.Errorf("invalid golden file %s: %w", path, err)
+	}
+
+	var report strings.Builder
+	idChanges(&report, "resource", golden.Resources, snapshot.Resources, resourceJSONKey)
+	idChanges(&report, "entitlement", golden.Entitlements, snapshot.Entitlements, idJSONKey)
+	idChanges(&report, "grant", golden.Grants, snapshot.Grants, idJSONKey)
+	firstDifference(&report, string(want), string(got))
+	return fmt.Errorf("%w %s:\n%s", ErrMismatch, path, report.String())
+}
+
+func idJSONKey(data json.RawMessage) string {
+	var object struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(data, &object)
+	return object.ID
+}
+
+func resourceJSONKey(data json.RawMessage) string {
+	var object struct {
+		ID struct {
+			ResourceType string `json:"resourceType"`
+			Resource     string `json:"resource"`
+		} `json:"id"`
+	}
+	_ = json.Unmarshal(data, &object)
+	return object.ID.ResourceType + ":" + object.ID.Resource
+}
+
+// idChanges reports the IDs that are only in one of want and got.
+func idChanges(report *strings.Builder, kind string, want, got []json.RawMessage, key func(json.RawMessage) string) {
+	wantIDs := make(map[string]bool)
+	for _, data := range want {
+		wantIDs[key(data)] = true
+	}
+	gotIDs := make(map[string]bool)
+	for _, data := range got {
+		gotIDs[key(data)] = true
+	}
+
+	for _, data := range want {
+		if id := key(data); !gotIDs[id] {
+			fmt.Fprintf(report, "  removed %s id %s\n", kind, id)
+		}
+	}
+	for _, data := range got {
+		if id := key(data); !wantIDs[id] {
+			fmt.Fprintf(report, "  added %s id %s\n", kind, id)
+		}
+	}
+}
+
+// firstDifference reports the first line that differs between want and got.
+func firstDifference(report *strings.Builder, want, got string) {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var wantLine, gotLine string
+		if i < len(wantLines) {
+			wantLine = wantLines[i]
+		}
+		if i < len(gotLines) {
+			gotLine = gotLines[i]
+		}
+		if wantLine != gotLine {
+			fmt.Fprintf(report, "  first difference at line %d:\n  - %s\n  + %s\n", i+1, wantLine, gotLine)
+			return
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// Package snowflake compares Discord snowflake IDs, which the API sends as decimal strings.
+package snowflake
+
+// Less reports whether the snowflake ID a is numerically less than b.
+func Less(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}